@@ -83,7 +83,8 @@ pub async fn run(opts: TestOptions) -> Result<()> {
                 path: input,
                 decoding: Decoding {
                     compression: DecodeCompression::None,
-                    format: DecodeFormat::JsonArray,
+                    format: test.format.unwrap_or(DecodeFormat::JsonArray),
+                    invalid_utf8: Default::default(),
                 },
             });
 
@@ -112,6 +113,10 @@ pub async fn run(opts: TestOptions) -> Result<()> {
                 workers: 1,
                 cache: CacheConfig::default(),
                 disable_remote_calls: !opts.enable_http,
+                remote_max_concurrency: cfg.runtime.remote_max_concurrency,
+                remote_max_response_bytes: cfg.runtime.remote_max_response_bytes,
+                fail_batch_on_malformed: cfg.runtime.fail_batch_on_malformed,
+                plugin_timing: cfg.runtime.plugin_timing,
             };
 
             let entry = Edge {
@@ -126,6 +131,8 @@ pub async fn run(opts: TestOptions) -> Result<()> {
                 to: vec![NodeRef::Sink {
                     name: "out".into(),
                     key_prefix: None,
+                    unknown_partition: None,
+                    max_partitions: None,
                 }],
             };
 
@@ -140,6 +147,9 @@ pub async fn run(opts: TestOptions) -> Result<()> {
                 path: plugins_path,
                 tests: vec![],
                 config: plugin_cfg.config.clone(),
+                allowed_hosts: plugin_cfg.allowed_hosts.clone(),
+                dead_letter_sink: None,
+                gen_types: vec![],
             };
 
             let mut plugins = BTreeMap::new();
@@ -33,7 +33,13 @@ pub fn compile_from_config(cfg_path: &PathBuf, wit_path: &PathBuf) -> Result<()>
 
         match plugin.module_type.as_str() {
             "python" => run_componentize_py(&wit_path, WORLD, &entry_point_path, &full_out)?,
-            "go" => run_go_compile(&wit_path, WORLD, &entry_point_path, &full_out)?,
+            "go" => run_go_compile(
+                &wit_path,
+                WORLD,
+                &entry_point_path,
+                &full_out,
+                &plugin.gen_types,
+            )?,
             "rust" => run_rust_compile(&entry_point_path, &full_out)?,
             ext => anyhow::bail!(
                 "unsupported filetype: {} for wasm entrypoint: {}",
@@ -177,17 +183,30 @@ fn run_go_compile(
     world: &str,
     entry_point_path: &Path,
     out_component: &Path,
+    gen_types: &[String],
 ) -> Result<()> {
     ensure_tinygo()?;
 
+    // tangentgen only generates encoders for types it sees passed to
+    // Wire[T], so configured types are listed for it in a scratch file that
+    // exists only while it runs.
+    let types_file = entry_point_path.join("tangentgen_types.go");
+    if !gen_types.is_empty() {
+        fs::write(&types_file, gen_types_source(gen_types))
+            .with_context(|| format!("writing {}", types_file.display()))?;
+    }
     let status = Command::new("go")
         .current_dir(&entry_point_path)
         .arg("run")
         .arg("github.com/telophasehq/tangent-sdk-go/gen")
         .stdout(Stdio::inherit())
         .stderr(Stdio::inherit())
-        .status()
-        .with_context(|| "running go gen")?;
+        .status();
+    if !gen_types.is_empty() {
+        fs::remove_file(&types_file)
+            .with_context(|| format!("removing {}", types_file.display()))?;
+    }
+    let status = status.with_context(|| "running go gen")?;
 
     if !status.success() {
         bail!(
@@ -227,6 +246,22 @@ fn run_go_compile(
     Ok(())
 }
 
+fn gen_types_source(gen_types: &[String]) -> String {
+    let mut src = String::from(
+        "// Code generated by tangent plugin compile; DO NOT EDIT.\n\n\
+         package main\n\n\
+         import tangent_sdk \"github.com/telophasehq/tangent-sdk-go\"\n\n\
+         func _() {\n",
+    );
+    for t in gen_types {
+        src.push_str(&format!(
+            "\ttangent_sdk.Wire[*{t}](tangent_sdk.Metadata{{}}, nil, nil, nil)\n"
+        ));
+    }
+    src.push_str("}\n");
+    src
+}
+
 fn run_rust_compile(entry_point_path: &Path, out_component: &Path) -> Result<()> {
     ensure_cargo_component()?;
 
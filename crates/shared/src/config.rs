@@ -79,10 +79,7 @@ impl Config {
             match n {
                 NodeRef::Source { name } => this.sources.contains_key(name),
                 NodeRef::Plugin { name } => this.plugins.contains_key(name),
-                NodeRef::Sink {
-                    name,
-                    key_prefix: _,
-                } => this.sinks.contains_key(name),
+                NodeRef::Sink { name, .. } => this.sinks.contains_key(name),
             }
         };
 
@@ -96,6 +93,15 @@ impl Config {
                 }
             }
         }
+        for (name, p) in &self.plugins {
+            if let Some(dl) = &p.dead_letter_sink {
+                if !self.sinks.contains_key(dl) {
+                    missing.push(format!(
+                        "dead_letter_sink {dl:?} of plugin {name:?} does not exist"
+                    ));
+                }
+            }
+        }
         if !missing.is_empty() {
             anyhow::bail!(
                 "DAG references missing nodes:\n  - {}",
@@ -15,6 +15,15 @@ pub enum NodeRef {
         name: Arc<str>,
         #[serde(default, skip_serializing_if = "Option::is_none")]
         key_prefix: Option<Arc<str>>,
+        /// Substituted for `{field}`/`{time:...}` placeholders in key_prefix
+        /// that a record can't fill. Defaults to `__unknown__`.
+        #[serde(default, skip_serializing_if = "Option::is_none")]
+        unknown_partition: Option<Arc<str>>,
+        /// Distinct prefixes a templated key_prefix may render on this edge;
+        /// each one keeps a WAL file open. Records that would add another go
+        /// to the unknown partition instead. Defaults to 1000.
+        #[serde(default, skip_serializing_if = "Option::is_none")]
+        max_partitions: Option<usize>,
     },
 }
 
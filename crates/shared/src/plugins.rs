@@ -2,6 +2,9 @@ use ahash::HashMap;
 use serde::{Deserialize, Serialize};
 use serde_json::Value;
 use std::path::PathBuf;
+use std::sync::Arc;
+
+use crate::sources::common::DecodeFormat;
 
 #[derive(Debug, Clone, Serialize, Deserialize, Default)]
 pub struct PluginConfig {
@@ -13,10 +16,33 @@ pub struct PluginConfig {
 
     #[serde(default)]
     pub config: HashMap<String, Value>,
+
+    /// Hosts the plugin may reach through remote calls: exact hostnames or
+    /// `*.example.com` wildcards. Redirects are checked hop by hop. Unset
+    /// means any host.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub allowed_hosts: Option<Vec<String>>,
+
+    /// Sink that receives the inputs of a batch the plugin rejected, one JSON
+    /// record per log: `{"handler", "error", "time", "raw"}` with `raw` base64.
+    /// Unset means rejected batches are logged and dropped.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dead_letter_sink: Option<Arc<str>>,
+
+    /// Go plugins: output types to generate JSON encoders for besides those
+    /// passed explicitly to `Wire[T]`. Lists the classes a plugin emits when
+    /// it wires a wrapper type that marshals them itself.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub gen_types: Vec<String>,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct PluginTests {
     pub input: PathBuf,
     pub expected: PathBuf,
+
+    /// How to decode `input`. Defaults to JSON (one object, an array, or
+    /// NDJSON).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub format: Option<DecodeFormat>,
 }
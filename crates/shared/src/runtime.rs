@@ -23,6 +23,31 @@ pub struct RuntimeConfig {
     /// Useful for `tangent plugin test` or benchmarking to avoid external calls.
     #[serde(default)]
     pub disable_remote_calls: bool,
+
+    /// Maximum requests from one plugin `call-batch` kept in flight at once.
+    /// Responses always come back in request order.
+    #[serde(default = "default_remote_max_concurrency")]
+    pub remote_max_concurrency: usize,
+
+    /// Default cap on a remote response body handed to a plugin, used unless
+    /// a request sets a non-zero x-tangent-max-response-bytes header. Longer
+    /// bodies are cut at the cap and the response gets an
+    /// x-tangent-truncated: true header.
+    #[serde(default = "default_remote_max_response_bytes")]
+    pub remote_max_response_bytes: u64,
+
+    /// Input logs that are not valid JSON are skipped and counted in
+    /// `tangent_malformed_logs_total`; the rest of their batch is processed.
+    /// When true, one malformed log drops its whole batch instead: nothing
+    /// from the batch is forwarded and its input is acked.
+    #[serde(default)]
+    pub fail_batch_on_malformed: bool,
+
+    /// Records `tangent_plugin_seconds` for every process-logs call and sets
+    /// `tangent_plugin_batch_seconds_per_log` once per batch. Set false to
+    /// skip the per-plugin metric updates on the hot path.
+    #[serde(default = "default_plugin_timing")]
+    pub plugin_timing: bool,
 }
 
 #[must_use]
@@ -42,6 +67,18 @@ fn default_plugin_path() -> PathBuf {
     "plugins/".into()
 }
 
+const fn default_remote_max_concurrency() -> usize {
+    8
+}
+
+const fn default_remote_max_response_bytes() -> u64 {
+    16 * 1024 * 1024
+}
+
+const fn default_plugin_timing() -> bool {
+    true
+}
+
 fn default_cache() -> CacheConfig {
     CacheConfig::default()
 }
@@ -0,0 +1,47 @@
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+
+use serde::{Deserialize, Serialize};
+
+#[derive(Debug, Deserialize, Serialize)]
+pub struct AzureBlobConfig {
+    /// Storage account name; used to build the default blob endpoint.
+    pub account: String,
+    pub container: String,
+
+    /// Shared access signature appended to every request. Falls back to
+    /// `AZURE_STORAGE_SAS_TOKEN` when unset.
+    #[serde(default)]
+    pub sas_token: Option<String>,
+
+    /// Overrides `https://<account>.blob.core.windows.net`, e.g. for Azurite.
+    #[serde(default)]
+    pub endpoint: Option<String>,
+
+    #[serde(default = "wal_path")]
+    pub wal_path: PathBuf,
+
+    #[serde(default = "max_file_age_seconds")]
+    pub max_file_age_seconds: u64,
+
+    /// Blob file name under the key prefix; same placeholders as the S3 sink.
+    #[serde(default)]
+    pub key_template: Option<String>,
+
+    /// Overrides the Content-Type derived from the sink encoding.
+    #[serde(default)]
+    pub content_type: Option<String>,
+
+    /// User metadata stored on every blob (`x-ms-meta-*`). Names must be
+    /// valid C# identifiers, e.g. `{ producer: tangent, schema: ocsf_1_5 }`.
+    #[serde(default)]
+    pub object_metadata: BTreeMap<String, String>,
+}
+
+fn wal_path() -> PathBuf {
+    "/tmp/wal-azure".into()
+}
+
+const fn max_file_age_seconds() -> u64 {
+    60
+}
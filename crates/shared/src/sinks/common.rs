@@ -1,6 +1,6 @@
 use serde::{Deserialize, Serialize};
 
-use crate::sinks::{blackhole, file, s3};
+use crate::sinks::{azure_blob, blackhole, file, kafka, s3};
 
 #[derive(Debug, Deserialize, Serialize)]
 pub struct SinkConfig {
@@ -16,8 +16,12 @@ pub struct SinkConfig {
 pub enum SinkKind {
     #[serde(rename = "s3")]
     S3(s3::S3Config),
+    #[serde(rename = "azure_blob")]
+    AzureBlob(azure_blob::AzureBlobConfig),
     #[serde(rename = "file")]
     File(file::FileConfig),
+    #[serde(rename = "kafka")]
+    Kafka(kafka::KafkaConfig),
     #[serde(rename = "blackhole")]
     Blackhole(blackhole::BlackholeConfig),
 }
@@ -52,6 +56,60 @@ pub enum Encoding {
     Parquet {
         schema: String,
     },
+    /// One row per record, RFC 4180 quoted, with a header row per object.
+    Csv {
+        columns: Vec<ColumnSpec>,
+    },
+    /// Like `Csv`, tab separated; tabs, newlines and backslashes in values
+    /// are backslash-escaped.
+    Tsv {
+        columns: Vec<ColumnSpec>,
+    },
+}
+
+/// A delimited-output column. Written either as a bare dotted path, which is
+/// also the header, or as `{ header, path, default }`.
+#[derive(Debug, Clone, PartialEq, Deserialize, Serialize)]
+#[serde(from = "ColumnSpecRepr")]
+pub struct ColumnSpec {
+    pub header: String,
+    pub path: String,
+    /// Written when the record has no value at `path`.
+    pub default: String,
+}
+
+#[derive(Deserialize)]
+#[serde(untagged)]
+enum ColumnSpecRepr {
+    Path(String),
+    Full {
+        #[serde(default)]
+        header: Option<String>,
+        path: String,
+        #[serde(default)]
+        default: String,
+    },
+}
+
+impl From<ColumnSpecRepr> for ColumnSpec {
+    fn from(r: ColumnSpecRepr) -> Self {
+        match r {
+            ColumnSpecRepr::Path(path) => Self {
+                header: path.clone(),
+                path,
+                default: String::new(),
+            },
+            ColumnSpecRepr::Full {
+                header,
+                path,
+                default,
+            } => Self {
+                header: header.unwrap_or_else(|| path.clone()),
+                path,
+                default,
+            },
+        }
+    }
 }
 
 impl Encoding {
@@ -61,15 +119,25 @@ impl Encoding {
             Self::JSON => "application/json",
             Self::Avro { .. } => "application/avro",
             Self::Parquet { .. } => "application/vnd.apache.parquet",
+            Self::Csv { .. } => "text/csv",
+            Self::Tsv { .. } => "text/tab-separated-values",
         }
     }
 
+    /// Avro and Parquet compress inside the file, so objects in them get no
+    /// outer compression, content-encoding or compression suffix.
+    pub const fn compresses_itself(&self) -> bool {
+        matches!(self, Self::Avro { .. } | Self::Parquet { .. })
+    }
+
     pub const fn extension(&self) -> &'static str {
         match self {
             Self::NDJSON => "ndjson",
             Self::JSON => "json",
             Self::Avro { .. } => "avro",
             Self::Parquet { .. } => "parquet",
+            Self::Csv { .. } => "csv",
+            Self::Tsv { .. } => "tsv",
         }
     }
 }
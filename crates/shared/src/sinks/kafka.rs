@@ -0,0 +1,31 @@
+use serde::{Deserialize, Serialize};
+
+use crate::sources::msk::MSKAuth;
+
+#[derive(Debug, Deserialize, Serialize)]
+pub struct KafkaConfig {
+    pub bootstrap_servers: String,
+    pub topic: String,
+
+    /// Dotted path into each record whose value becomes the message key, e.g.
+    /// `metadata.uid` or `src_endpoint.ip`. Records without it get a null key.
+    #[serde(default)]
+    pub key_field: Option<String>,
+
+    #[serde(default = "default_protocol")]
+    pub security_protocol: String,
+
+    #[serde(default)]
+    pub ssl_ca_location: Option<String>,
+    #[serde(default)]
+    pub ssl_certificate_location: Option<String>,
+    #[serde(default)]
+    pub ssl_key_location: Option<String>,
+
+    #[serde(default)]
+    pub auth: Option<MSKAuth>,
+}
+
+fn default_protocol() -> String {
+    "PLAINTEXT".into()
+}
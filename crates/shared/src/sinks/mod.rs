@@ -1,4 +1,6 @@
+pub mod azure_blob;
 pub mod blackhole;
 pub mod common;
 pub mod file;
+pub mod kafka;
 pub mod s3;
@@ -1,3 +1,4 @@
+use std::collections::BTreeMap;
 use std::path::PathBuf;
 
 use serde::{Deserialize, Serialize};
@@ -12,6 +13,27 @@ pub struct S3Config {
 
     #[serde(default = "max_file_age_seconds")]
     pub max_file_age_seconds: u64,
+
+    /// Object file name under the key prefix, e.g. `{sink}-{time:%Y%m%dT%H%M%S}-{uuid}`.
+    /// Placeholders: `{sink}`, `{module}` (the plugin that produced the
+    /// batch), `{time:FMT}` (batch start, strftime), `{uuid}`, `{seq}` (fixed
+    /// per batch, counting on across restarts of the same WAL dir) and
+    /// `{batch_id}` (hash of the plugin's input batch and `module@version`,
+    /// the same when that input is replayed; each plugin batch then gets an
+    /// object of its own). It must contain `{uuid}` or `{batch_id}` so
+    /// objects don't overwrite each other. The encoding/compression extension
+    /// is appended. When unset the object is named after its WAL file.
+    #[serde(default)]
+    pub key_template: Option<String>,
+
+    /// Overrides the Content-Type derived from the sink encoding.
+    #[serde(default)]
+    pub content_type: Option<String>,
+
+    /// User metadata stored on every object (`x-amz-meta-*`), e.g.
+    /// `{ producer: tangent, schema: ocsf-1.5 }`.
+    #[serde(default)]
+    pub object_metadata: BTreeMap<String, String>,
 }
 
 fn wal_path() -> PathBuf {
@@ -29,10 +29,13 @@ pub enum SourceConfig {
 
 #[derive(Debug, Clone, Deserialize, Serialize)]
 pub struct Decoding {
-    pub format: DecodeFormat, // ndjson | json | json-array | text | msgpack
+    pub format: DecodeFormat, // ndjson | json | json-array | text | msgpack | zeek-tsv
 
     #[serde(default)]
     pub compression: DecodeCompression, // auto | none | gzip | zstd
+
+    #[serde(default)]
+    pub invalid_utf8: InvalidUtf8, // reject | replace | passthrough
 }
 
 impl Decoding {
@@ -81,11 +84,13 @@ impl Decoding {
     }
 }
 
-fn is_gzip(b: &[u8]) -> bool {
+/// Whether `b` starts with the gzip magic bytes.
+pub fn is_gzip(b: &[u8]) -> bool {
     b.len() >= 2 && b[0] == 0x1f && b[1] == 0x8b
 }
 
-fn is_zstd(b: &[u8]) -> bool {
+/// Whether `b` starts with the zstd frame magic number.
+pub fn is_zstd(b: &[u8]) -> bool {
     b.len() >= 4 && b[0] == 0x28 && b[1] == 0xB5 && b[2] == 0x2F && b[3] == 0xFD
 }
 
@@ -97,6 +102,28 @@ pub enum DecodeFormat {
     JsonArray,
     Msgpack,
     Text,
+    /// Zeek's default ASCII logs: tab-separated rows under `#fields`/`#types`
+    /// headers, decoded into the records Zeek's JSON writer would emit. The
+    /// headers must arrive with the rows, so this suits whole-file sources.
+    ZeekTsv,
+}
+
+/// What to do with input lines holding invalid UTF-8 or control bytes
+/// (NUL and other C0 controls besides tab, CR and LF). Applies to every
+/// source that reads raw lines: file, msk, sqs, tcp and socket.
+///
+/// The default is `reject`. Sources used to forward such lines untouched;
+/// set `passthrough` to keep that behaviour.
+#[derive(Debug, Clone, Default, Deserialize, Serialize)]
+#[serde(tag = "type", rename_all = "kebab-case")]
+pub enum InvalidUtf8 {
+    /// Drop the line with a warning naming it and the offending byte.
+    #[default]
+    Reject,
+    /// Substitute U+FFFD for invalid sequences and strip control bytes.
+    Replace,
+    /// Forward the bytes untouched.
+    Passthrough,
 }
 
 #[derive(Debug, Clone, Deserialize, Serialize)]
@@ -1,10 +1,15 @@
 use serde::{Deserialize, Serialize};
 use std::path::PathBuf;
 
+use crate::sources::common::InvalidUtf8;
+
 #[derive(Debug, Deserialize, Serialize)]
 pub struct SocketConfig {
     #[serde(default = "default_socket_path")]
     pub socket_path: PathBuf,
+
+    #[serde(default)]
+    pub invalid_utf8: InvalidUtf8,
 }
 
 fn default_socket_path() -> PathBuf {
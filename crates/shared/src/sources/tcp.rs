@@ -1,6 +1,8 @@
 use serde::{Deserialize, Serialize};
 use std::net::SocketAddr;
 
+use crate::sources::common::InvalidUtf8;
+
 #[derive(Debug, Deserialize, Serialize)]
 pub struct TcpConfig {
     #[serde(default = "default_bind_address")]
@@ -8,6 +10,14 @@ pub struct TcpConfig {
 
     #[serde(default = "default_read_buffer_size")]
     pub read_buffer_size: usize,
+
+    /// Largest single record accepted. A longer line is dropped up to its
+    /// next newline and parsing resumes after it.
+    #[serde(default = "default_max_line_bytes")]
+    pub max_line_bytes: usize,
+
+    #[serde(default)]
+    pub invalid_utf8: InvalidUtf8,
 }
 
 fn default_bind_address() -> SocketAddr {
@@ -19,3 +29,7 @@ fn default_bind_address() -> SocketAddr {
 const fn default_read_buffer_size() -> usize {
     512 * 1024
 }
+
+const fn default_max_line_bytes() -> usize {
+    16 * 1024 * 1024
+}
@@ -7,7 +7,7 @@ use fs2::FileExt;
 use once_cell::sync::Lazy;
 use parking_lot::Mutex;
 use rusqlite::types::Value;
-use rusqlite::{params, Connection, OpenFlags};
+use rusqlite::{params, Connection, OpenFlags, OptionalExtension};
 use tangent_shared::runtime::CacheConfig;
 use tracing::info;
 
@@ -63,6 +63,17 @@ impl CacheHandle {
                 updated_at INTEGER NOT NULL
             );
             CREATE INDEX IF NOT EXISTS cache_expires_idx ON cache(expires_at);
+            CREATE TABLE IF NOT EXISTS cache_list(
+                key TEXT NOT NULL,
+                seq INTEGER NOT NULL,
+                value TEXT NOT NULL,
+                PRIMARY KEY(key, seq)
+            );
+            CREATE TABLE IF NOT EXISTS cache_set(
+                key TEXT NOT NULL,
+                member TEXT NOT NULL,
+                PRIMARY KEY(key, member)
+            ) WITHOUT ROWID;
             "#,
         )
         .context("creating schema")?;
@@ -90,10 +101,17 @@ impl CacheHandle {
             let expires_at: i64 = row.get(2)?;
             if expires_at <= now as i64 {
                 drop(rows);
-                conn.execute("DELETE FROM cache WHERE key = ?1", params![key])?;
+                drop(stmt);
+                let tx = conn.unchecked_transaction()?;
+                tx.execute("DELETE FROM cache WHERE key = ?1", params![key])?;
+                drop_members(&tx, key)?;
+                tx.commit()?;
                 return Ok(None);
             }
             let kind: String = row.get(0)?;
+            if is_container(&kind) {
+                return Ok(None);
+            }
             let val: Value = row.get(1)?;
             return Ok(Some(Scalar::from_sqlite(&kind, val)?));
         }
@@ -104,38 +122,453 @@ impl CacheHandle {
     pub fn set(&self, key: &str, v: &Scalar, ttl_ms: Option<u64>) -> Result<()> {
         let (kind, val) = v.to_sqlite();
 
-        let ttl = ttl_ms.unwrap_or(self.default_ttl_ms).min(self.max_ttl_ms);
-        let expires_at = now_ms()
-            .checked_add(ttl)
-            .ok_or_else(|| anyhow!("ttl overflow"))?;
+        let expires_at = self.expires_at(ttl_ms)?;
         let updated_at = now_ms();
 
-        let conn = self.conn.lock();
-        conn.execute(
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+        tx.execute(
             "INSERT INTO cache(key, kind, value, expires_at, updated_at)
              VALUES (?1, ?2, ?3, ?4, ?5)
              ON CONFLICT(key) DO UPDATE SET kind=excluded.kind, value=excluded.value, expires_at=excluded.expires_at, updated_at=excluded.updated_at",
             rusqlite::params![key, kind, val, expires_at as i64, updated_at as i64],
         )?;
+        drop_members(&tx, key)?;
+        tx.commit()?;
         Ok(())
     }
 
-    pub fn del(&self, key: &str) -> Result<bool> {
+    /// Returns the remaining lifetime of `key`, or `None` if it is missing or
+    /// expired.
+    pub fn ttl(&self, key: &str) -> Result<Option<u64>> {
+        let now = now_ms();
+        let conn = self.conn.lock();
+        let expires_at: Option<i64> = conn
+            .query_row(
+                "SELECT expires_at FROM cache WHERE key = ?1",
+                params![key],
+                |row| row.get(0),
+            )
+            .optional()?;
+
+        Ok(expires_at
+            .filter(|at| *at > now as i64)
+            .map(|at| at as u64 - now))
+    }
+
+    /// Resets the lifetime of a live key, reporting whether the key existed.
+    pub fn expire(&self, key: &str, ttl_ms: u64) -> Result<bool> {
+        let expires_at = self.expires_at(Some(ttl_ms))?;
+        let now = now_ms();
+
+        let conn = self.conn.lock();
+        let rows = conn.execute(
+            "UPDATE cache SET expires_at = ?2, updated_at = ?3 WHERE key = ?1 AND expires_at > ?3",
+            params![key, expires_at as i64, now as i64],
+        )?;
+        Ok(rows > 0)
+    }
+
+    /// Looks up every key in one pass; missing and expired keys, and lists and
+    /// sets, are left out of the result rather than reported as errors.
+    pub fn get_many(&self, keys: &[String]) -> Result<Vec<(String, Scalar)>> {
+        let now = now_ms();
+        let conn = self.conn.lock();
+        let mut stmt =
+            conn.prepare_cached("SELECT kind, value, expires_at FROM cache WHERE key = ?1")?;
+
+        let mut out = Vec::with_capacity(keys.len());
+        for key in keys {
+            let row: Option<(String, Value, i64)> = stmt
+                .query_row(params![key], |row| {
+                    Ok((row.get(0)?, row.get(1)?, row.get(2)?))
+                })
+                .optional()?;
+            if let Some((kind, val, expires_at)) = row {
+                if expires_at > now as i64 && !is_container(&kind) {
+                    out.push((key.clone(), Scalar::from_sqlite(&kind, val)?));
+                }
+            }
+        }
+        Ok(out)
+    }
+
+    pub fn set_many(&self, entries: &[(String, Scalar)], ttl_ms: Option<u64>) -> Result<()> {
+        let expires_at = self.expires_at(ttl_ms)?;
+        let updated_at = now_ms();
+
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+        {
+            let mut stmt = tx.prepare_cached(
+                "INSERT INTO cache(key, kind, value, expires_at, updated_at)
+                 VALUES (?1, ?2, ?3, ?4, ?5)
+                 ON CONFLICT(key) DO UPDATE SET kind=excluded.kind, value=excluded.value, expires_at=excluded.expires_at, updated_at=excluded.updated_at",
+            )?;
+            for (key, v) in entries {
+                let (kind, val) = v.to_sqlite();
+                stmt.execute(params![
+                    key,
+                    kind,
+                    val,
+                    expires_at as i64,
+                    updated_at as i64
+                ])?;
+                drop_members(&tx, key)?;
+            }
+        }
+        tx.commit()?;
+        Ok(())
+    }
+
+    /// Stores `v` only if `key` is absent or expired, reporting whether the
+    /// write happened.
+    pub fn set_nx(&self, key: &str, v: &Scalar, ttl_ms: Option<u64>) -> Result<bool> {
+        let (kind, val) = v.to_sqlite();
+
+        let expires_at = self.expires_at(ttl_ms)?;
+        let now = now_ms();
+
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+        let rows = tx.execute(
+            "INSERT INTO cache(key, kind, value, expires_at, updated_at)
+             VALUES (?1, ?2, ?3, ?4, ?5)
+             ON CONFLICT(key) DO UPDATE SET kind=excluded.kind, value=excluded.value, expires_at=excluded.expires_at, updated_at=excluded.updated_at
+             WHERE cache.expires_at <= ?5",
+            rusqlite::params![key, kind, val, expires_at as i64, now as i64],
+        )?;
+        if rows > 0 {
+            drop_members(&tx, key)?;
+        }
+        tx.commit()?;
+        Ok(rows > 0)
+    }
+
+    /// Replaces the value at `key` with `next` only if it currently equals
+    /// `expected`; `None` means the key must be missing or expired. Values are
+    /// compared on their stored form (kind plus SQLite value), so `Int(1)`
+    /// never matches `Float(1.0)`. Floats compare bit-for-bit, which SQL `=`
+    /// doesn't do (it treats 0.0 and -0.0 as equal), so the match is checked
+    /// here rather than in the UPDATE.
+    pub fn cas(
+        &self,
+        key: &str,
+        expected: Option<&Scalar>,
+        next: &Scalar,
+        ttl_ms: Option<u64>,
+    ) -> Result<bool> {
+        let Some(expected) = expected else {
+            return self.set_nx(key, next, ttl_ms);
+        };
+        let (want_kind, want_val) = expected.to_sqlite();
+        let (kind, val) = next.to_sqlite();
+
+        let expires_at = self.expires_at(ttl_ms)?;
+        let now = now_ms();
+
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+
+        let current: Option<(String, Value)> = tx
+            .query_row(
+                "SELECT kind, value FROM cache WHERE key = ?1 AND expires_at > ?2",
+                params![key, now as i64],
+                |row| Ok((row.get(0)?, row.get(1)?)),
+            )
+            .optional()?;
+        match current {
+            Some((k, v)) if k == want_kind && same_value(&v, &want_val) => {}
+            _ => return Ok(false),
+        }
+
+        tx.execute(
+            "UPDATE cache SET kind = ?2, value = ?3, expires_at = ?4, updated_at = ?5 WHERE key = ?1",
+            rusqlite::params![key, kind, val, expires_at as i64, now as i64],
+        )?;
+        drop_members(&tx, key)?;
+        tx.commit()?;
+        Ok(true)
+    }
+
+    /// Adds `delta` to the integer stored at `key` and returns the new value.
+    /// A missing or expired key is created at `delta`; the TTL only applies on
+    /// creation, so increments never extend the key's lifetime.
+    pub fn incr(&self, key: &str, delta: i64, ttl_ms: Option<u64>) -> Result<i64> {
+        let now = now_ms();
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+
+        let existing: Option<(String, Value, i64)> = tx
+            .query_row(
+                "SELECT kind, value, expires_at FROM cache WHERE key = ?1",
+                params![key],
+                |row| Ok((row.get(0)?, row.get(1)?, row.get(2)?)),
+            )
+            .optional()?;
+
+        let next = match existing {
+            Some((kind, val, expires_at)) if expires_at > now as i64 => {
+                let current = match Scalar::from_sqlite(&kind, val)? {
+                    Scalar::Int(i) => i,
+                    _ => anyhow::bail!("cache value at {key} is not an integer"),
+                };
+                let next = current
+                    .checked_add(delta)
+                    .ok_or_else(|| anyhow!("counter overflow at {key}"))?;
+                tx.execute(
+                    "UPDATE cache SET value = ?2, updated_at = ?3 WHERE key = ?1",
+                    params![key, next, now as i64],
+                )?;
+                next
+            }
+            _ => {
+                let expires_at = self.expires_at(ttl_ms)?;
+                tx.execute(
+                    "INSERT INTO cache(key, kind, value, expires_at, updated_at)
+                     VALUES (?1, 'int', ?2, ?3, ?4)
+                     ON CONFLICT(key) DO UPDATE SET kind=excluded.kind, value=excluded.value, expires_at=excluded.expires_at, updated_at=excluded.updated_at",
+                    params![key, delta, expires_at as i64, now as i64],
+                )?;
+                drop_members(&tx, key)?;
+                delta
+            }
+        };
+
+        tx.commit()?;
+        Ok(next)
+    }
+
+    /// Appends `values` to the list at `key`. The TTL applies only when the
+    /// push creates the list, matching `set` on a fresh key.
+    pub fn push_list(&self, key: &str, values: &[String], ttl_ms: Option<u64>) -> Result<()> {
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+
+        self.claim_container(&tx, key, "list", "cache_list", ttl_ms)?;
+        {
+            let mut stmt = tx.prepare_cached(
+                "INSERT INTO cache_list(key, seq, value)
+                 VALUES (?1, (SELECT COALESCE(MAX(seq) + 1, 0) FROM cache_list WHERE key = ?1), ?2)",
+            )?;
+            for v in values {
+                stmt.execute(params![key, v])?;
+            }
+        }
+
+        tx.commit()?;
+        Ok(())
+    }
+
+    /// Returns the list at `key` in push order; missing lists are empty.
+    pub fn get_list(&self, key: &str) -> Result<Vec<String>> {
+        let conn = self.conn.lock();
+        if !container_live(&conn, key, "list")? {
+            return Ok(Vec::new());
+        }
+
+        let mut stmt =
+            conn.prepare_cached("SELECT value FROM cache_list WHERE key = ?1 ORDER BY seq")?;
+        let values = stmt
+            .query_map(params![key], |row| row.get(0))?
+            .collect::<rusqlite::Result<Vec<String>>>()?;
+        Ok(values)
+    }
+
+    /// Keeps only the `max` most recently pushed entries of the list at `key`.
+    pub fn trim_list(&self, key: &str, max: u32) -> Result<()> {
         let conn = self.conn.lock();
-        let rows = conn.execute("DELETE FROM cache WHERE key = ?1", params![key])?;
+        if !container_live(&conn, key, "list")? {
+            return Ok(());
+        }
+        conn.execute(
+            "DELETE FROM cache_list WHERE key = ?1 AND seq NOT IN
+               (SELECT seq FROM cache_list WHERE key = ?1 ORDER BY seq DESC LIMIT ?2)",
+            params![key, max],
+        )?;
+        Ok(())
+    }
+
+    /// Adds `member` to the set at `key`, returning whether it was new. The
+    /// TTL applies only when the add creates the set.
+    pub fn add_to_set(&self, key: &str, member: &str, ttl_ms: Option<u64>) -> Result<bool> {
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+
+        self.claim_container(&tx, key, "set", "cache_set", ttl_ms)?;
+        let rows = tx.execute(
+            "INSERT OR IGNORE INTO cache_set(key, member) VALUES (?1, ?2)",
+            params![key, member],
+        )?;
+
+        tx.commit()?;
         Ok(rows > 0)
     }
 
+    pub fn set_contains(&self, key: &str, member: &str) -> Result<bool> {
+        let conn = self.conn.lock();
+        if !container_live(&conn, key, "set")? {
+            return Ok(false);
+        }
+
+        let found = conn
+            .query_row(
+                "SELECT 1 FROM cache_set WHERE key = ?1 AND member = ?2",
+                params![key, member],
+                |_| Ok(()),
+            )
+            .optional()?;
+        Ok(found.is_some())
+    }
+
+    /// Returns the members of the set at `key` in sorted order.
+    pub fn set_members(&self, key: &str) -> Result<Vec<String>> {
+        let conn = self.conn.lock();
+        if !container_live(&conn, key, "set")? {
+            return Ok(Vec::new());
+        }
+
+        let mut stmt =
+            conn.prepare_cached("SELECT member FROM cache_set WHERE key = ?1 ORDER BY member")?;
+        let members = stmt
+            .query_map(params![key], |row| row.get(0))?
+            .collect::<rusqlite::Result<Vec<String>>>()?;
+        Ok(members)
+    }
+
+    /// Makes `key` a live container of `kind`, clearing members left behind by
+    /// an expired predecessor. Errors if a live value of another kind is there.
+    fn claim_container(
+        &self,
+        tx: &rusqlite::Transaction<'_>,
+        key: &str,
+        kind: &str,
+        members_table: &str,
+        ttl_ms: Option<u64>,
+    ) -> Result<()> {
+        if container_live(tx, key, kind)? {
+            return Ok(());
+        }
+
+        let expires_at = self.expires_at(ttl_ms)?;
+        tx.execute(
+            &format!("DELETE FROM {members_table} WHERE key = ?1"),
+            params![key],
+        )?;
+        tx.execute(
+            "INSERT INTO cache(key, kind, value, expires_at, updated_at)
+             VALUES (?1, ?2, x'', ?3, ?4)
+             ON CONFLICT(key) DO UPDATE SET kind=excluded.kind, value=excluded.value, expires_at=excluded.expires_at, updated_at=excluded.updated_at",
+            params![key, kind, expires_at as i64, now_ms() as i64],
+        )?;
+        Ok(())
+    }
+
+    pub fn del(&self, key: &str) -> Result<bool> {
+        let mut conn = self.conn.lock();
+        let tx = conn.transaction()?;
+        let rows = tx.execute("DELETE FROM cache WHERE key = ?1", params![key])?;
+        drop_members(&tx, key)?;
+        tx.commit()?;
+        Ok(rows > 0)
+    }
+
+    /// Lists live keys under `prefix` in key order, starting after `after`.
+    /// Pages are not a consistent snapshot: keys written or expiring between
+    /// calls may or may not appear. UTF-8 keys never contain 0xff, so
+    /// `?1 || x'ff'` bounds the prefix as a range the key index can serve.
+    pub fn scan(&self, prefix: &str, after: Option<&str>, limit: u32) -> Result<Vec<String>> {
+        let now = now_ms();
+        let conn = self.conn.lock();
+        let mut stmt = conn.prepare_cached(
+            "SELECT key FROM cache
+             WHERE key >= ?1 AND key < ?1 || x'ff' AND (?2 IS NULL OR key > ?2) AND expires_at > ?3
+             ORDER BY key LIMIT ?4",
+        )?;
+        let keys = stmt
+            .query_map(params![prefix, after, now as i64, limit], |row| row.get(0))?
+            .collect::<rusqlite::Result<Vec<String>>>()?;
+        Ok(keys)
+    }
+
+    pub fn del_prefix(&self, prefix: &str) -> Result<u64> {
+        let conn = self.conn.lock();
+        let rows = conn.execute(
+            "DELETE FROM cache WHERE key >= ?1 AND key < ?1 || x'ff'",
+            params![prefix],
+        )?;
+        conn.execute(
+            "DELETE FROM cache_list WHERE key >= ?1 AND key < ?1 || x'ff'",
+            params![prefix],
+        )?;
+        conn.execute(
+            "DELETE FROM cache_set WHERE key >= ?1 AND key < ?1 || x'ff'",
+            params![prefix],
+        )?;
+        Ok(rows as u64)
+    }
+
+    fn expires_at(&self, ttl_ms: Option<u64>) -> Result<u64> {
+        let ttl = ttl_ms.unwrap_or(self.default_ttl_ms).min(self.max_ttl_ms);
+        now_ms()
+            .checked_add(ttl)
+            .ok_or_else(|| anyhow!("ttl overflow"))
+    }
+
     pub fn reset(&self) -> Result<()> {
         let conn = self.conn.lock();
         let _ = conn
             .execute("drop table cache", rusqlite::params![])
             .map_err(|e| anyhow!(e))?;
+        conn.execute("DROP TABLE IF EXISTS cache_list", rusqlite::params![])?;
+        conn.execute("DROP TABLE IF EXISTS cache_set", rusqlite::params![])?;
 
         Ok(())
     }
 }
 
+/// Clears the list and set members of `key`, for writes that replace or drop
+/// its `cache` row.
+fn drop_members(conn: &Connection, key: &str) -> Result<()> {
+    conn.execute("DELETE FROM cache_list WHERE key = ?1", params![key])?;
+    conn.execute("DELETE FROM cache_set WHERE key = ?1", params![key])?;
+    Ok(())
+}
+
+/// Compares stored values exactly, floats by their bits.
+fn same_value(a: &Value, b: &Value) -> bool {
+    match (a, b) {
+        (Value::Real(x), Value::Real(y)) => x.to_bits() == y.to_bits(),
+        _ => a == b,
+    }
+}
+
+/// Lists and sets keep their members in side tables, so their `cache` row
+/// holds no scalar and reads as absent to `get`.
+fn is_container(kind: &str) -> bool {
+    matches!(kind, "list" | "set")
+}
+
+fn container_live(conn: &Connection, key: &str, kind: &str) -> Result<bool> {
+    let existing: Option<(String, i64)> = conn
+        .query_row(
+            "SELECT kind, expires_at FROM cache WHERE key = ?1",
+            params![key],
+            |row| Ok((row.get(0)?, row.get(1)?)),
+        )
+        .optional()?;
+
+    match existing {
+        Some((k, expires_at)) if expires_at > now_ms() as i64 => {
+            if k != kind {
+                anyhow::bail!("cache value at {key} is a {k}, not a {kind}");
+            }
+            Ok(true)
+        }
+        _ => Ok(false),
+    }
+}
+
 fn acquire_lock(path: &Path, timeout: Duration) -> Result<std::fs::File> {
     let mut lock_path = path.to_path_buf();
     lock_path.set_extension("sqlite.lock");
@@ -167,3 +600,225 @@ fn now_ms() -> u64 {
         .unwrap_or_default()
         .as_millis() as u64
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn open_temp() -> (tempfile::TempDir, CacheHandle) {
+        let dir = tempfile::tempdir().unwrap();
+        let cfg = CacheConfig {
+            path: dir.path().join("cache.sqlite"),
+            ..CacheConfig::default()
+        };
+        let cache = CacheHandle::open(&cfg, dir.path()).unwrap();
+        (dir, cache)
+    }
+
+    fn member_rows(cache: &CacheHandle, key: &str) -> i64 {
+        cache
+            .conn
+            .lock()
+            .query_row(
+                "SELECT (SELECT COUNT(*) FROM cache_list WHERE key = ?1)
+                      + (SELECT COUNT(*) FROM cache_set WHERE key = ?1)",
+                params![key],
+                |row| row.get(0),
+            )
+            .unwrap()
+    }
+
+    #[test]
+    fn incr_is_atomic_across_threads() {
+        let (_dir, cache) = open_temp();
+
+        let handles: Vec<_> = (0..8)
+            .map(|_| {
+                let cache = cache.clone();
+                std::thread::spawn(move || {
+                    for _ in 0..100 {
+                        cache.incr("hits", 1, None).unwrap();
+                    }
+                })
+            })
+            .collect();
+        for h in handles {
+            h.join().unwrap();
+        }
+
+        assert_eq!(cache.incr("hits", 0, None).unwrap(), 800);
+        assert_eq!(cache.incr("hits", -800, None).unwrap(), 0);
+    }
+
+    #[test]
+    fn scan_pages_past_limit() {
+        let (_dir, cache) = open_temp();
+        for i in 0..5 {
+            cache
+                .set(&format!("npm-publish-started-{i}"), &Scalar::Int(i), None)
+                .unwrap();
+        }
+        cache.set("other", &Scalar::Int(0), None).unwrap();
+
+        let mut seen = Vec::new();
+        let mut after: Option<String> = None;
+        loop {
+            let page = cache
+                .scan("npm-publish-started-", after.as_deref(), 2)
+                .unwrap();
+            if page.is_empty() {
+                break;
+            }
+            assert!(page.len() <= 2);
+            after = page.last().cloned();
+            seen.extend(page);
+        }
+
+        assert_eq!(seen.len(), 5);
+        assert!(seen.iter().all(|k| k.starts_with("npm-publish-started-")));
+    }
+
+    #[test]
+    fn list_push_trim_and_read() {
+        let (_dir, cache) = open_temp();
+        cache
+            .push_list("pkgs", &["a".into(), "b".into()], None)
+            .unwrap();
+        cache.push_list("pkgs", &["c".into()], None).unwrap();
+        assert_eq!(cache.get_list("pkgs").unwrap(), vec!["a", "b", "c"]);
+
+        cache.trim_list("pkgs", 2).unwrap();
+        assert_eq!(cache.get_list("pkgs").unwrap(), vec!["b", "c"]);
+
+        assert!(cache.get_list("missing").unwrap().is_empty());
+        cache.set("scalar", &Scalar::Int(1), None).unwrap();
+        assert!(cache.push_list("scalar", &["x".into()], None).is_err());
+    }
+
+    #[test]
+    fn set_add_dedups_large_sets() {
+        let (_dir, cache) = open_temp();
+        let start = std::time::Instant::now();
+        for i in 0..10_000 {
+            assert!(cache
+                .add_to_set("seen", &format!("10.0.{}.{}", i / 256, i % 256), None)
+                .unwrap());
+        }
+        assert!(!cache.add_to_set("seen", "10.0.0.0", None).unwrap());
+        assert!(cache.set_contains("seen", "10.0.39.15").unwrap());
+        assert!(!cache.set_contains("seen", "192.168.0.1").unwrap());
+        assert_eq!(cache.set_members("seen").unwrap().len(), 10_000);
+        assert!(
+            start.elapsed() < std::time::Duration::from_secs(30),
+            "10k set adds took {:?}",
+            start.elapsed()
+        );
+    }
+
+    #[test]
+    fn cas_swaps_only_on_match() {
+        let (_dir, cache) = open_temp();
+        let started = Scalar::Str("started".into());
+        let named = Scalar::Str("named".into());
+
+        assert!(cache.cas("step", None, &started, None).unwrap());
+        assert!(!cache.cas("step", None, &named, None).unwrap());
+        assert!(cache.cas("step", Some(&started), &named, None).unwrap());
+        assert!(!cache.cas("step", Some(&started), &named, None).unwrap());
+
+        cache.set("n", &Scalar::Int(1), None).unwrap();
+        assert!(!cache
+            .cas("n", Some(&Scalar::Float(1.0)), &Scalar::Int(2), None)
+            .unwrap());
+    }
+
+    #[test]
+    fn cas_compares_floats_bitwise() {
+        let (_dir, cache) = open_temp();
+        cache.set("f", &Scalar::Float(-0.0), None).unwrap();
+
+        assert!(!cache
+            .cas("f", Some(&Scalar::Float(0.0)), &Scalar::Float(1.0), None)
+            .unwrap());
+        assert!(cache
+            .cas("f", Some(&Scalar::Float(-0.0)), &Scalar::Float(0.0), None)
+            .unwrap());
+        assert!(!cache
+            .cas("f", Some(&Scalar::Float(-0.0)), &Scalar::Float(1.0), None)
+            .unwrap());
+    }
+
+    #[test]
+    fn scalar_reads_skip_containers() {
+        let (_dir, cache) = open_temp();
+        cache.push_list("pkgs", &["a".into()], None).unwrap();
+        cache.add_to_set("seen", "10.0.0.1", None).unwrap();
+        cache.set("n", &Scalar::Int(1), None).unwrap();
+
+        assert!(cache.get("pkgs").unwrap().is_none());
+        assert!(cache.get("seen").unwrap().is_none());
+        let found = cache
+            .get_many(&["pkgs".into(), "n".into(), "seen".into()])
+            .unwrap();
+        assert_eq!(found.len(), 1);
+        assert_eq!(found[0].0, "n");
+    }
+
+    #[test]
+    fn replacing_a_container_drops_its_members() {
+        let (_dir, cache) = open_temp();
+        cache
+            .push_list("pkgs", &["a".into(), "b".into()], None)
+            .unwrap();
+        cache.set("pkgs", &Scalar::Int(1), None).unwrap();
+        assert_eq!(member_rows(&cache, "pkgs"), 0);
+        assert!(cache.trim_list("pkgs", 1).is_err());
+
+        cache.add_to_set("seen", "10.0.0.1", None).unwrap();
+        cache.incr("seen", 1, None).unwrap_err();
+        cache.del("seen").unwrap();
+        assert_eq!(cache.incr("seen", 1, None).unwrap(), 1);
+        assert_eq!(member_rows(&cache, "seen"), 0);
+
+        cache.push_list("short", &["x".into()], Some(1)).unwrap();
+        std::thread::sleep(Duration::from_millis(5));
+        assert!(cache.get("short").unwrap().is_none());
+        assert_eq!(member_rows(&cache, "short"), 0);
+    }
+
+    #[test]
+    fn del_prefix_stays_within_prefix() {
+        let (_dir, cache) = open_temp();
+        cache.set("a/1", &Scalar::Int(1), None).unwrap();
+        cache.push_list("a/2", &["x".into()], None).unwrap();
+        cache.set("a0", &Scalar::Int(1), None).unwrap();
+        cache.set("b/1", &Scalar::Int(1), None).unwrap();
+
+        assert_eq!(cache.scan("a/", None, 10).unwrap(), vec!["a/1", "a/2"]);
+        assert_eq!(cache.del_prefix("a/").unwrap(), 2);
+        assert_eq!(member_rows(&cache, "a/2"), 0);
+        assert_eq!(cache.scan("", None, 10).unwrap(), vec!["a0", "b/1"]);
+    }
+
+    #[test]
+    fn set_nx_writes_once() {
+        let (_dir, cache) = open_temp();
+
+        let handles: Vec<_> = (0..2)
+            .map(|i| {
+                let cache = cache.clone();
+                std::thread::spawn(move || cache.set_nx("first", &Scalar::Int(i), None).unwrap())
+            })
+            .collect();
+        let wins = handles
+            .into_iter()
+            .map(|h| h.join().unwrap())
+            .filter(|won| *won)
+            .count();
+
+        assert_eq!(wins, 1);
+        assert!(!cache
+            .set_nx("first", &Scalar::Str("late".into()), None)
+            .unwrap());
+    }
+}
@@ -39,7 +39,14 @@ impl DagRuntime {
         let cache = Arc::new(CacheHandle::open(&cfg.runtime.cache.clone(), config_dir)?);
 
         let mut engines: Vec<WasmEngine> = (0..workers)
-            .map(|_| WasmEngine::new(cache.clone(), cfg.runtime.disable_remote_calls))
+            .map(|_| {
+                WasmEngine::new(
+                    cache.clone(),
+                    cfg.runtime.disable_remote_calls,
+                    cfg.runtime.remote_max_concurrency,
+                    cfg.runtime.remote_max_response_bytes,
+                )
+            })
             .collect::<Result<_, _>>()?;
         let mut components: Vec<Vec<(Arc<str>, Component)>> = Vec::with_capacity(workers);
         for i in 0..workers {
@@ -60,7 +67,12 @@ impl DagRuntime {
                 components[i].push((
                     Arc::clone(name),
                     engines[i]
-                        .load_precompiled(Arc::clone(name), &plugin_path, plugin_cfg.config.clone())
+                        .load_precompiled(
+                            Arc::clone(name),
+                            &plugin_path,
+                            plugin_cfg.config.clone(),
+                            plugin_cfg.allowed_hosts.as_deref(),
+                        )
                         .with_context(|| format!("loading {}", &component_file))?,
                 ));
             }
@@ -71,7 +83,14 @@ impl DagRuntime {
             outs.entry(e.from.clone()).or_default().extend(e.to.clone());
         }
 
-        let router = Arc::new(Router::new(outs, Arc::clone(&sink_manager)));
+        let dead_letters = cfg
+            .plugins
+            .iter()
+            .filter_map(|(name, p)| Some((Arc::clone(name), p.dead_letter_sink.clone()?)))
+            .collect();
+
+        let router =
+            Arc::new(Router::new(outs, Arc::clone(&sink_manager))?.with_dead_letters(dead_letters));
 
         let batch_size = cfg.batch_size_kb();
         let batch_age = cfg.batch_age_ms();
@@ -84,6 +103,8 @@ impl DagRuntime {
                 components,
                 batch_size,
                 batch_age,
+                cfg.runtime.fail_batch_on_malformed,
+                cfg.runtime.plugin_timing,
                 Arc::clone(&router),
             )
             .await?,
@@ -331,7 +352,7 @@ mod tests {
             1,
         ));
 
-        let router = Arc::new(Router::new(HashMap::default(), Arc::clone(&sink_manager)));
+        let router = Arc::new(Router::new(HashMap::default(), Arc::clone(&sink_manager)).unwrap());
         let worker_pool = Arc::new(WorkerPool::new_for_test(vec![tokio::spawn(async move {})]));
 
         let runtime = DagRuntime {
@@ -347,6 +368,8 @@ mod tests {
             .enqueue(
                 sink_name.clone(),
                 None,
+                None,
+                None,
                 BytesMut::from("{\"msg\":\"block\"}\n"),
                 vec![ack_dyn],
             )
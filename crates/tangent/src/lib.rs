@@ -5,8 +5,8 @@ use tokio_util::sync::CancellationToken;
 use tracing::info;
 
 use prometheus::{
-    register_histogram_vec, register_int_counter, register_int_gauge, HistogramVec, IntCounter,
-    IntGauge,
+    register_gauge_vec, register_histogram_vec, register_int_counter, register_int_counter_vec,
+    register_int_gauge, GaugeVec, HistogramVec, IntCounter, IntCounterVec, IntGauge,
 };
 
 use tangent_shared::Config;
@@ -45,6 +45,28 @@ lazy_static::lazy_static! {
         vec![5e-5,1e-4,2e-4,4e-4,8e-4,1.6e-3,3.2e-3,6.4e-3,1.28e-2,2.56e-2,5.12e-2,0.102,0.204,0.409,0.819,1.638]
     ).unwrap();
 
+    pub static ref PLUGIN_LOGS_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_plugin_logs_total",
+        "Logs per plugin by outcome: matched (sent to the plugin), emitted (output records), errored (in a rejected batch)",
+        &["plugin", "outcome"]
+    ).unwrap();
+
+    pub static ref PLUGIN_LATENCY: HistogramVec = register_histogram_vec!(
+        "tangent_plugin_seconds",
+        "process-logs call latency per plugin (sec); _sum is cumulative time, _count invocations",
+        &["plugin"],
+        vec![5e-5,1e-4,2e-4,4e-4,8e-4,1.6e-3,3.2e-3,6.4e-3,1.28e-2,2.56e-2,5.12e-2,0.102,0.204,0.409,0.819,1.638]
+    ).unwrap();
+
+    pub static ref PLUGIN_BATCH_SECONDS_PER_LOG: GaugeVec = register_gauge_vec!(
+        "tangent_plugin_batch_seconds_per_log",
+        "Per plugin, from the last batch that ran it: its slowest process-logs call's time divided by the logs that call was given (sec)",
+        &["plugin"]
+    ).unwrap();
+
+    pub static ref UNMATCHED_LOGS_TOTAL: IntCounter =
+        register_int_counter!("tangent_unmatched_logs_total", "Input logs no plugin selector matched").unwrap();
+
     pub static ref GUEST_BYTES_TOTAL: IntCounter =
         register_int_counter!("tangent_guest_bytes_total", "Bytes fed to WASM guest").unwrap();
 
@@ -54,6 +76,12 @@ lazy_static::lazy_static! {
     pub static ref CONSUMER_OBJECTS_TOTAL: IntCounter =
         register_int_counter!("tangent_consumer_objects_total", "Objects consumed (raw input)").unwrap();
 
+    pub static ref MALFORMED_LOGS_TOTAL: IntCounter =
+        register_int_counter!("tangent_malformed_logs_total", "Input logs skipped because they are not valid JSON").unwrap();
+
+    pub static ref ZEEK_TSV_DROPPED_ROWS_TOTAL: IntCounter =
+        register_int_counter!("tangent_zeek_tsv_dropped_rows_total", "Zeek TSV rows dropped because their column count does not match #fields").unwrap();
+
     pub static ref WAL_SEALED_BYTES_TOTAL: IntCounter =
         register_int_counter!("tangent_wal_sealed_bytes_total", "Bytes sealed to WAL files").unwrap();
 
@@ -69,6 +97,36 @@ lazy_static::lazy_static! {
     pub static ref SINK_OBJECTS_TOTAL: IntCounter =
         register_int_counter!("tangent_sink_objects_total", "Objects sent to sink").unwrap();
 
+    pub static ref CACHE_OPS_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_cache_ops_total",
+        "Guest cache calls by plugin, operation and result: hit or miss for get and ttl, ok otherwise, or error",
+        &["plugin", "op", "result"]
+    ).unwrap();
+
+    pub static ref BLACKHOLE_RECORDS_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_blackhole_records_total",
+        "Records dropped by a blackhole sink",
+        &["sink"]
+    ).unwrap();
+
+    pub static ref BLACKHOLE_BYTES_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_blackhole_bytes_total",
+        "Bytes dropped by a blackhole sink",
+        &["sink"]
+    ).unwrap();
+
+    pub static ref PARTITION_OVERFLOW_RECORDS_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_partition_overflow_records_total",
+        "Records sent to the unknown partition because their sink edge reached max_partitions",
+        &["sink"]
+    ).unwrap();
+
+    pub static ref DEAD_LETTER_RECORDS_TOTAL: IntCounterVec = register_int_counter_vec!(
+        "tangent_dead_letter_records_total",
+        "Plugin inputs written to a dead-letter sink",
+        &["plugin"]
+    ).unwrap();
+
     pub static ref INFLIGHT: IntGauge =
         register_int_gauge!("tangent_inflight", "Batches enqueued but not yet persisted").unwrap();
 
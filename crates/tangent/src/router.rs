@@ -1,7 +1,10 @@
 use ahash::AHashMap as HashMap;
+use ahash::AHashSet as HashSet;
 use anyhow::Result;
 use async_trait::async_trait;
+use base64::Engine;
 use bytes::BytesMut;
+use parking_lot::Mutex;
 use std::sync::{
     atomic::{AtomicUsize, Ordering},
     Arc, Weak,
@@ -10,18 +13,23 @@ use tangent_shared::dag::NodeRef;
 use tokio::sync::OnceCell;
 
 use crate::{
-    sinks::manager::SinkManager,
+    sinks::{
+        manager::SinkManager,
+        prefix::{PrefixTemplate, DEFAULT_MAX_PARTITIONS, DEFAULT_UNKNOWN_PARTITION},
+    },
     worker::{Ack, Record, WorkerPool},
+    DEAD_LETTER_RECORDS_TOTAL, PARTITION_OVERFLOW_RECORDS_TOTAL,
 };
 
+/// Acks its inners once it has itself been acked `n` times.
 #[derive(Clone)]
-struct RefCountAck {
+pub(crate) struct RefCountAck {
     remaining: Arc<AtomicUsize>,
     inners: Arc<Vec<Arc<dyn Ack>>>,
 }
 
 impl RefCountAck {
-    fn new(inner: Vec<Arc<dyn Ack>>, n: usize) -> Self {
+    pub(crate) fn new(inner: Vec<Arc<dyn Ack>>, n: usize) -> Self {
         Self {
             remaining: Arc::new(AtomicUsize::new(n)),
             inners: Arc::new(inner),
@@ -45,15 +53,205 @@ pub struct Router {
     outs: HashMap<NodeRef, Vec<NodeRef>>,
     pool: OnceCell<Weak<WorkerPool>>,
     sink_manager: Arc<SinkManager>,
+    templates: HashMap<Arc<str>, PrefixTemplate>,
+    /// Prefixes each (sink, key_prefix) edge has rendered, for max_partitions.
+    /// WAL routes stay open once created, so these never shrink either.
+    partitions: Mutex<HashMap<(Arc<str>, Arc<str>), HashSet<String>>>,
+    /// Plugins feeding a sink that names objects by `{batch_id}`.
+    batch_ids: HashSet<Arc<str>>,
+    dead_letters: HashMap<Arc<str>, Arc<str>>,
 }
 
 impl Router {
-    pub fn new(outs: HashMap<NodeRef, Vec<NodeRef>>, sink_manager: Arc<SinkManager>) -> Self {
-        Self {
+    pub fn new(
+        outs: HashMap<NodeRef, Vec<NodeRef>>,
+        sink_manager: Arc<SinkManager>,
+    ) -> Result<Self> {
+        let mut templates = HashMap::new();
+        let mut batch_ids = HashSet::new();
+        for (from, tos) in &outs {
+            if let NodeRef::Plugin { name } = from {
+                let by_batch = tos.iter().any(|to| match to {
+                    NodeRef::Sink { name: sink, .. } => sink_manager.uses_batch_id(sink),
+                    _ => false,
+                });
+                if by_batch {
+                    batch_ids.insert(name.clone());
+                }
+            }
+        }
+        for to in outs.values().flatten() {
+            if let NodeRef::Sink {
+                key_prefix: Some(kp),
+                ..
+            } = to
+            {
+                if let Some(t) = PrefixTemplate::parse(kp)? {
+                    templates.insert(kp.clone(), t);
+                }
+            }
+        }
+
+        Ok(Self {
             outs,
             pool: OnceCell::new(),
             sink_manager,
+            templates,
+            partitions: Mutex::new(HashMap::new()),
+            batch_ids,
+            dead_letters: HashMap::new(),
+        })
+    }
+
+    /// Maps plugin names to the sink that receives their rejected batches.
+    pub fn with_dead_letters(mut self, dead_letters: HashMap<Arc<str>, Arc<str>>) -> Self {
+        self.dead_letters = dead_letters;
+        self
+    }
+
+    pub fn has_dead_letter(&self, plugin: &str) -> bool {
+        self.dead_letters.contains_key(plugin)
+    }
+
+    /// Whether the plugin's output goes to a sink keyed by `{batch_id}`, so
+    /// its input batches need fingerprinting; see [`crate::worker::batch_id`].
+    pub fn wants_batch_id(&self, plugin: &str) -> bool {
+        self.batch_ids.contains(plugin)
+    }
+
+    /// Writes the inputs of a rejected batch to the plugin's dead-letter sink.
+    /// `acks` fire once the dead letters are written, or right away when
+    /// there is nothing to write.
+    pub async fn dead_letter(
+        &self,
+        plugin: &Arc<str>,
+        error: &str,
+        raws: &[Vec<u8>],
+        acks: Vec<Arc<dyn Ack>>,
+    ) -> Result<()> {
+        let sink = match self.dead_letters.get(plugin) {
+            Some(sink) if !raws.is_empty() => sink,
+            _ => {
+                for a in acks {
+                    let _ = a.ack().await;
+                }
+                return Ok(());
+            }
+        };
+
+        let time = chrono::Utc::now().timestamp_millis();
+        let mut frame = BytesMut::new();
+        for raw in raws {
+            let rec = serde_json::json!({
+                "handler": plugin.as_ref(),
+                "error": error,
+                "time": time,
+                "raw": base64::engine::general_purpose::STANDARD.encode(raw),
+            });
+            frame.extend_from_slice(&serde_json::to_vec(&rec)?);
+            frame.extend_from_slice(b"\n");
+        }
+        DEAD_LETTER_RECORDS_TOTAL
+            .with_label_values(&[plugin.as_ref()])
+            .inc_by(raws.len() as u64);
+
+        self.sink_manager
+            .enqueue(sink.clone(), None, Some(plugin.clone()), None, frame, acks)
+            .await
+    }
+
+    /// Enqueues a frame for a sink. A templated key_prefix is rendered per
+    /// record and the frame split so each partition buffers separately. Once
+    /// the edge has rendered `max_partitions` prefixes, records that would
+    /// open another go to the prefix rendered with every placeholder unknown.
+    async fn enqueue_sink(
+        &self,
+        name: &Arc<str>,
+        key_prefix: &Option<Arc<str>>,
+        unknown_partition: &Option<Arc<str>>,
+        max_partitions: Option<usize>,
+        module: &Option<Arc<str>>,
+        batch_id: &Option<Arc<str>>,
+        frame: BytesMut,
+        ack: Arc<dyn Ack>,
+    ) -> Result<()> {
+        let Some((kp, tpl)) = key_prefix
+            .as_ref()
+            .and_then(|kp| Some((kp, self.templates.get(kp)?)))
+        else {
+            return self
+                .sink_manager
+                .enqueue(
+                    name.clone(),
+                    key_prefix.clone(),
+                    module.clone(),
+                    batch_id.clone(),
+                    frame,
+                    vec![ack],
+                )
+                .await;
+        };
+        let unknown = unknown_partition
+            .as_deref()
+            .unwrap_or(DEFAULT_UNKNOWN_PARTITION);
+
+        let max_partitions = max_partitions.unwrap_or(DEFAULT_MAX_PARTITIONS);
+        let overflow = tpl.render(&serde_json::Value::Null, unknown);
+
+        let mut groups: Vec<(Arc<str>, BytesMut)> = Vec::new();
+        let mut index: HashMap<String, usize> = HashMap::new();
+        let mut overflowed = 0;
+        {
+            let mut partitions = self.partitions.lock();
+            let seen = partitions.entry((name.clone(), kp.clone())).or_default();
+            for line in frame[..].split(|b| *b == b'\n').filter(|l| !l.is_empty()) {
+                let mut prefix = tpl.render(&tpl.record(line), unknown);
+                if !seen.contains(&prefix) {
+                    if seen.len() < max_partitions || prefix == overflow {
+                        seen.insert(prefix.clone());
+                    } else {
+                        overflowed += 1;
+                        seen.insert(overflow.clone());
+                        prefix = overflow.clone();
+                    }
+                }
+                let ix = *index.entry(prefix).or_insert_with_key(|p| {
+                    groups.push((Arc::from(p.as_str()), BytesMut::new()));
+                    groups.len() - 1
+                });
+                let buf = &mut groups[ix].1;
+                buf.extend_from_slice(line);
+                buf.extend_from_slice(b"\n");
+            }
+        }
+        if overflowed > 0 {
+            PARTITION_OVERFLOW_RECORDS_TOTAL
+                .with_label_values(&[name.as_ref()])
+                .inc_by(overflowed);
+        }
+
+        if groups.is_empty() {
+            return ack.ack().await;
         }
+
+        let ack: Arc<dyn Ack> = if groups.len() == 1 {
+            ack
+        } else {
+            Arc::new(RefCountAck::new(vec![ack], groups.len()))
+        };
+        for (prefix, buf) in groups {
+            self.sink_manager
+                .enqueue(
+                    name.clone(),
+                    Some(prefix),
+                    module.clone(),
+                    batch_id.clone(),
+                    buf,
+                    vec![ack.clone()],
+                )
+                .await?;
+        }
+        Ok(())
     }
 
     pub fn set_pool(&self, pool: &Arc<WorkerPool>) {
@@ -65,9 +263,21 @@ impl Router {
     }
 
     pub async fn forward(
+        &self,
+        from: &NodeRef,
+        frames: Vec<BytesMut>,
+        acks: Vec<Arc<dyn Ack>>,
+    ) -> Result<()> {
+        self.forward_batch(from, frames, None, acks).await
+    }
+
+    /// Like `forward`, for the output of one plugin batch. `batch_id` goes
+    /// with the frames to the sinks, for `{batch_id}` in their key templates.
+    pub async fn forward_batch(
         &self,
         from: &NodeRef,
         mut frames: Vec<BytesMut>,
+        batch_id: Option<Arc<str>>,
         acks: Vec<Arc<dyn Ack>>,
     ) -> Result<()> {
         let Some(tos) = self.outs.get(from) else {
@@ -97,6 +307,10 @@ impl Router {
         }
 
         let shared = Arc::new(RefCountAck::new(acks, deliveries));
+        let module = match from {
+            NodeRef::Plugin { name } => Some(name.clone()),
+            _ => None,
+        };
 
         if tos.len() == 1 {
             let to = &tos[0];
@@ -110,15 +324,23 @@ impl Router {
                         };
                         pool.dispatch(rec).await?;
                     }
-                    NodeRef::Sink { name, key_prefix } => {
-                        self.sink_manager
-                            .enqueue(
-                                name.clone(),
-                                key_prefix.clone(),
-                                frame,
-                                vec![shared.clone()],
-                            )
-                            .await?;
+                    NodeRef::Sink {
+                        name,
+                        key_prefix,
+                        unknown_partition,
+                        max_partitions,
+                    } => {
+                        self.enqueue_sink(
+                            name,
+                            key_prefix,
+                            unknown_partition,
+                            *max_partitions,
+                            &module,
+                            &batch_id,
+                            frame,
+                            shared.clone(),
+                        )
+                        .await?;
                     }
                     NodeRef::Source { .. } => {
                         let _ = shared.ack().await;
@@ -142,15 +364,23 @@ impl Router {
                             let _ = shared.ack().await;
                         }
                     }
-                    NodeRef::Sink { name, key_prefix } => {
-                        self.sink_manager
-                            .enqueue(
-                                name.clone(),
-                                key_prefix.clone(),
-                                frame.clone(),
-                                vec![shared.clone()],
-                            )
-                            .await?;
+                    NodeRef::Sink {
+                        name,
+                        key_prefix,
+                        unknown_partition,
+                        max_partitions,
+                    } => {
+                        self.enqueue_sink(
+                            name,
+                            key_prefix,
+                            unknown_partition,
+                            *max_partitions,
+                            &module,
+                            &batch_id,
+                            frame.clone(),
+                            shared.clone(),
+                        )
+                        .await?;
                     }
                     NodeRef::Source { .. } => {
                         let _ = shared.ack().await;
@@ -161,3 +391,144 @@ impl Router {
         Ok(())
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::sinks::manager::{Sink, SinkWrite};
+    use std::collections::BTreeMap;
+    use tokio::sync::Mutex;
+
+    /// Counts the records written under each key prefix.
+    #[derive(Default)]
+    struct PrefixSink {
+        records: Mutex<BTreeMap<String, usize>>,
+    }
+
+    #[async_trait]
+    impl Sink for PrefixSink {
+        async fn write(&self, req: SinkWrite) -> Result<()> {
+            let prefix = req
+                .s3
+                .and_then(|s| s.key_prefix)
+                .map(|p| p.to_string())
+                .unwrap_or_default();
+            let n = req
+                .payload
+                .split(|b| *b == b'\n')
+                .filter(|l| !l.is_empty())
+                .count();
+            *self.records.lock().await.entry(prefix).or_default() += n;
+            Ok(())
+        }
+    }
+
+    #[tokio::test]
+    async fn zeek_logs_route_to_their_log_name_prefix() {
+        // The zeek example's DAG: one prefix per Zeek log, with records the
+        // plugin passes through unmapped set aside.
+        let from = NodeRef::Plugin {
+            name: Arc::from("zeek_all"),
+        };
+        let to = NodeRef::Sink {
+            name: Arc::from("s3_bucket"),
+            key_prefix: Some(Arc::from("zeek/{metadata.log_name}/")),
+            unknown_partition: Some(Arc::from("unmapped")),
+            max_partitions: None,
+        };
+        let outs: HashMap<NodeRef, Vec<NodeRef>> = [(from.clone(), vec![to])].into_iter().collect();
+
+        let sink = Arc::new(PrefixSink::default());
+        let manager = Arc::new(SinkManager::for_test_prefixed(
+            vec![(Arc::from("s3_bucket"), sink.clone() as Arc<dyn Sink>)],
+            4,
+        ));
+        let router = Router::new(outs, manager.clone()).unwrap();
+
+        // Mapped conn, dns and ssl events plus two passed-through records
+        // (http, capture_loss) that carry no metadata.
+        let records = [
+            serde_json::json!({"class_uid": 4001, "metadata": {"log_name": "conn"}}),
+            serde_json::json!({"class_uid": 4003, "metadata": {"log_name": "dns"}}),
+            serde_json::json!({"class_uid": 4001, "metadata": {"log_name": "conn"}}),
+            serde_json::json!({"uid": "CmRFd61N7G7YA909D1", "_path": "http"}),
+            serde_json::json!({"class_uid": 4001, "metadata": {"log_name": "ssl"}}),
+            serde_json::json!({"peer": "sensor", "_path": "capture_loss"}),
+        ];
+        let mut frame = BytesMut::new();
+        for r in &records {
+            frame.extend_from_slice(&serde_json::to_vec(r).unwrap());
+            frame.extend_from_slice(b"\n");
+        }
+
+        router
+            .forward(&from, vec![frame], Vec::new())
+            .await
+            .unwrap();
+        drop(router);
+        Arc::into_inner(manager).unwrap().join().await.unwrap();
+
+        let got = sink.records.lock().await.clone();
+        let want: BTreeMap<String, usize> = [
+            ("zeek/conn/", 2),
+            ("zeek/dns/", 1),
+            ("zeek/ssl/", 1),
+            ("zeek/unmapped/", 2),
+        ]
+        .into_iter()
+        .map(|(p, n)| (p.to_string(), n))
+        .collect();
+        assert_eq!(got, want);
+    }
+
+    #[tokio::test]
+    async fn partitions_past_max_go_to_the_unknown_partition() {
+        let from = NodeRef::Plugin {
+            name: Arc::from("flows"),
+        };
+        let to = NodeRef::Sink {
+            name: Arc::from("capped"),
+            key_prefix: Some(Arc::from("ip={src_ip}/")),
+            unknown_partition: Some(Arc::from("other")),
+            max_partitions: Some(2),
+        };
+        let outs: HashMap<NodeRef, Vec<NodeRef>> = [(from.clone(), vec![to])].into_iter().collect();
+
+        let sink = Arc::new(PrefixSink::default());
+        let manager = Arc::new(SinkManager::for_test_prefixed(
+            vec![(Arc::from("capped"), sink.clone() as Arc<dyn Sink>)],
+            4,
+        ));
+        let router = Router::new(outs, manager.clone()).unwrap();
+
+        // a and b take the two partitions; c and d arrive after the cap.
+        for ips in [["a", "b", "a"], ["c", "b", "d"]] {
+            let mut frame = BytesMut::new();
+            for ip in ips {
+                frame.extend_from_slice(
+                    &serde_json::to_vec(&serde_json::json!({"src_ip": ip})).unwrap(),
+                );
+                frame.extend_from_slice(b"\n");
+            }
+            router
+                .forward(&from, vec![frame], Vec::new())
+                .await
+                .unwrap();
+        }
+        drop(router);
+        Arc::into_inner(manager).unwrap().join().await.unwrap();
+
+        let got = sink.records.lock().await.clone();
+        let want: BTreeMap<String, usize> = [("ip=a/", 2), ("ip=b/", 2), ("ip=other/", 2)]
+            .into_iter()
+            .map(|(p, n)| (p.to_string(), n))
+            .collect();
+        assert_eq!(got, want);
+        assert_eq!(
+            PARTITION_OVERFLOW_RECORDS_TOTAL
+                .with_label_values(&["capped"])
+                .get(),
+            2
+        );
+    }
+}
@@ -0,0 +1,489 @@
+use anyhow::{bail, Context, Result};
+use async_trait::async_trait;
+use base64::Engine;
+use percent_encoding::{utf8_percent_encode, AsciiSet, NON_ALPHANUMERIC};
+use std::collections::BTreeMap;
+use std::path::Path;
+use std::sync::Arc;
+use tangent_shared::sinks::azure_blob::AzureBlobConfig;
+use tangent_shared::sinks::common::{Compression, Encoding};
+use tokio::fs::File;
+use tokio::io::AsyncReadExt;
+
+use crate::sinks::s3::{object_key_from, render_stem, KeyTemplate, S3SinkItem};
+use crate::sinks::wal::WALSink;
+
+const API_VERSION: &str = "2021-08-06";
+
+/// Blob path segments keep `-._~`; everything else non-alphanumeric is escaped.
+const SEGMENT: &AsciiSet = &NON_ALPHANUMERIC
+    .remove(b'-')
+    .remove(b'.')
+    .remove(b'_')
+    .remove(b'~');
+
+pub struct AzureBlobSink {
+    name: Arc<str>,
+    client: reqwest::Client,
+    endpoint: String,
+    container: String,
+    sas_token: String,
+    block_size: usize,
+    key_template: Option<KeyTemplate>,
+    content_type: Option<String>,
+    metadata: BTreeMap<String, String>,
+}
+
+#[async_trait]
+impl WALSink for AzureBlobSink {
+    async fn write_path_with(
+        &self,
+        path: &Path,
+        encoding: &Encoding,
+        compression: &Compression,
+        meta: &S3SinkItem,
+        seq: u64,
+    ) -> Result<()> {
+        let stem = render_stem(self.key_template.as_ref(), &self.name, meta, path, seq);
+        let blob = object_key_from(&stem, meta.key_prefix.as_deref(), encoding, compression);
+        let url = self.blob_url(&blob);
+
+        let content_type = self
+            .content_type
+            .as_deref()
+            .unwrap_or_else(|| Encoding::content_type(encoding));
+        let content_encoding = match compression {
+            Compression::Gzip { .. } => Some("gzip"),
+            Compression::Zstd { .. } => Some("zstd"),
+            _ => None,
+        };
+
+        let size = tokio::fs::metadata(path).await?.len();
+
+        if size <= self.block_size as u64 {
+            let body = tokio::fs::read(path)
+                .await
+                .with_context(|| format!("read {}", path.display()))?;
+            let mut put = self
+                .request(reqwest::Method::PUT, &url)
+                .header("x-ms-blob-type", "BlockBlob")
+                .header("content-type", content_type)
+                .body(body);
+            put = self.with_metadata(put);
+            if let Some(enc) = content_encoding {
+                put = put.header("content-encoding", enc);
+            }
+            send(put)
+                .await
+                .with_context(|| format!("put blob {}/{}", self.container, blob))?;
+            tracing::info!("upload completed {} to {}", blob, self.container);
+            return Ok(());
+        }
+
+        let mut file = File::open(path)
+            .await
+            .with_context(|| format!("open {}", path.display()))?;
+        let mut block_ids: Vec<String> = Vec::new();
+        let mut buf = vec![0u8; self.block_size];
+
+        loop {
+            let mut filled = 0usize;
+            while filled < buf.len() {
+                let n = file.read(&mut buf[filled..]).await?;
+                if n == 0 {
+                    break;
+                }
+                filled += n;
+            }
+            if filled == 0 {
+                break;
+            }
+
+            // Block ids must all be the same length within a blob.
+            let id =
+                base64::engine::general_purpose::STANDARD.encode(format!("{:08}", block_ids.len()));
+            let put = self
+                .request(
+                    reqwest::Method::PUT,
+                    &format!(
+                        "{url}&comp=block&blockid={}",
+                        utf8_percent_encode(&id, SEGMENT)
+                    ),
+                )
+                .body(buf[..filled].to_vec());
+            send(put).await.with_context(|| {
+                format!(
+                    "put block {} for sink {} blob {}",
+                    block_ids.len(),
+                    self.name,
+                    blob
+                )
+            })?;
+            block_ids.push(id);
+        }
+
+        if block_ids.is_empty() {
+            bail!("no data read for block upload: {}", path.display());
+        }
+
+        let mut list = String::from(r#"<?xml version="1.0" encoding="utf-8"?><BlockList>"#);
+        for id in &block_ids {
+            list.push_str("<Latest>");
+            list.push_str(id);
+            list.push_str("</Latest>");
+        }
+        list.push_str("</BlockList>");
+
+        let mut commit = self
+            .request(reqwest::Method::PUT, &format!("{url}&comp=blocklist"))
+            .header("x-ms-blob-content-type", content_type)
+            .body(list);
+        commit = self.with_metadata(commit);
+        if let Some(enc) = content_encoding {
+            commit = commit.header("x-ms-blob-content-encoding", enc);
+        }
+        send(commit)
+            .await
+            .with_context(|| format!("put block list {}/{}", self.container, blob))?;
+
+        tracing::info!("upload completed {} to {}", blob, self.container);
+        Ok(())
+    }
+
+    fn uses_batch_id(&self) -> bool {
+        self.key_template
+            .as_ref()
+            .is_some_and(KeyTemplate::uses_batch_id)
+    }
+}
+
+impl AzureBlobSink {
+    pub fn new(name: Arc<str>, cfg: &AzureBlobConfig) -> Result<Self> {
+        let key_template = cfg
+            .key_template
+            .as_deref()
+            .map(KeyTemplate::parse)
+            .transpose()
+            .with_context(|| format!("sink {name}: key_template"))?;
+
+        let sas_token = match &cfg.sas_token {
+            Some(t) if !t.is_empty() => t.clone(),
+            _ => std::env::var("AZURE_STORAGE_SAS_TOKEN").with_context(|| {
+                format!("sink {name}: set sas_token or AZURE_STORAGE_SAS_TOKEN")
+            })?,
+        };
+
+        if let Some(bad) = cfg.object_metadata.keys().find(|k| !is_metadata_name(k)) {
+            bail!("sink {name}: object_metadata name {bad:?} must be a C# identifier");
+        }
+
+        let endpoint = cfg
+            .endpoint
+            .clone()
+            .unwrap_or_else(|| format!("https://{}.blob.core.windows.net", cfg.account));
+
+        Ok(Self {
+            name,
+            client: reqwest::Client::new(),
+            endpoint: endpoint.trim_end_matches('/').to_string(),
+            container: cfg.container.clone(),
+            sas_token: sas_token.trim_start_matches('?').to_string(),
+            block_size: 8 * 1024 * 1024,
+            key_template,
+            content_type: cfg.content_type.clone(),
+            metadata: cfg.object_metadata.clone(),
+        })
+    }
+
+    fn blob_url(&self, blob: &str) -> String {
+        let path: Vec<String> = blob
+            .split('/')
+            .map(|seg| utf8_percent_encode(seg, SEGMENT).to_string())
+            .collect();
+        format!(
+            "{}/{}/{}?{}",
+            self.endpoint,
+            self.container,
+            path.join("/"),
+            self.sas_token
+        )
+    }
+
+    fn request(&self, method: reqwest::Method, url: &str) -> reqwest::RequestBuilder {
+        self.client
+            .request(method, url)
+            .header("x-ms-version", API_VERSION)
+    }
+
+    /// Blob metadata is set by whichever request creates the blob: the single
+    /// PUT, or the block list commit.
+    fn with_metadata(&self, mut req: reqwest::RequestBuilder) -> reqwest::RequestBuilder {
+        for (k, v) in &self.metadata {
+            req = req.header(format!("x-ms-meta-{k}"), v);
+        }
+        req
+    }
+}
+
+/// Azure metadata names follow C# identifier rules.
+fn is_metadata_name(name: &str) -> bool {
+    let mut chars = name.chars();
+    chars
+        .next()
+        .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+        && chars.all(|c| c.is_ascii_alphanumeric() || c == '_')
+}
+
+async fn send(req: reqwest::RequestBuilder) -> Result<()> {
+    let resp = req.send().await?;
+    let status = resp.status();
+    if status.is_success() {
+        return Ok(());
+    }
+    let body = resp.text().await.unwrap_or_default();
+    bail!("status {status}: {body}");
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use axum::{
+        body::{to_bytes, Body},
+        extract::State,
+        http::{Request, StatusCode},
+        serve, Router as AxumRouter,
+    };
+    use std::collections::VecDeque;
+    use std::sync::Mutex;
+    use tokio::net::TcpListener;
+
+    fn config(endpoint: Option<String>, key_template: Option<&str>) -> AzureBlobConfig {
+        AzureBlobConfig {
+            account: "lake".into(),
+            container: "logs".into(),
+            sas_token: Some("?sv=2021&sig=abc".into()),
+            endpoint,
+            wal_path: "/tmp/wal-azure".into(),
+            max_file_age_seconds: 60,
+            key_template: key_template.map(String::from),
+            content_type: None,
+            object_metadata: BTreeMap::new(),
+        }
+    }
+
+    struct Seen {
+        method: String,
+        uri: String,
+        headers: axum::http::HeaderMap,
+        body: Vec<u8>,
+    }
+
+    /// Records every request and answers with the queued statuses, then 201.
+    #[derive(Clone, Default)]
+    struct Mock {
+        seen: Arc<Mutex<Vec<Seen>>>,
+        statuses: Arc<Mutex<VecDeque<StatusCode>>>,
+    }
+
+    async fn record(State(mock): State<Mock>, req: Request<Body>) -> (StatusCode, &'static str) {
+        let (parts, body) = req.into_parts();
+        let body = to_bytes(body, usize::MAX).await.unwrap();
+        mock.seen.lock().unwrap().push(Seen {
+            method: parts.method.to_string(),
+            uri: parts.uri.to_string(),
+            headers: parts.headers,
+            body: body.to_vec(),
+        });
+        match mock.statuses.lock().unwrap().pop_front() {
+            Some(status) => (status, "ServerBusy"),
+            None => (StatusCode::CREATED, ""),
+        }
+    }
+
+    async fn mock_endpoint(mock: &Mock) -> String {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let addr = listener.local_addr().unwrap();
+        let app = AxumRouter::new().fallback(record).with_state(mock.clone());
+        tokio::spawn(async move { serve(listener, app).await });
+        format!("http://{addr}")
+    }
+
+    fn meta(key_prefix: Option<&str>, module: Option<&str>) -> S3SinkItem {
+        S3SinkItem {
+            bucket_name: Arc::from("logs"),
+            key_prefix: key_prefix.map(Arc::from),
+            module: module.map(Arc::from),
+            batch_id: None,
+        }
+    }
+
+    #[test]
+    fn blob_url_escapes_segments_and_keeps_sas() {
+        let sink = AzureBlobSink::new(Arc::from("az"), &config(None, None)).unwrap();
+        assert_eq!(
+            sink.blob_url("zeek/dt=2025-01-01/a b.ndjson"),
+            "https://lake.blob.core.windows.net/logs/zeek/dt%3D2025-01-01/a%20b.ndjson?sv=2021&sig=abc"
+        );
+    }
+
+    #[tokio::test]
+    async fn uploads_to_the_rendered_blob_name() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("01ARZ3NDEKTSV4RRFFQ69G5FAV.bin.sealed");
+        tokio::fs::write(&path, b"{\"x\":1}\n").await.unwrap();
+
+        let mock = Mock::default();
+        let endpoint = mock_endpoint(&mock).await;
+        let sink = AzureBlobSink::new(
+            Arc::from("az"),
+            &config(Some(endpoint), Some("{module}/{sink}-{seq}-{uuid}")),
+        )
+        .unwrap();
+        sink.write_path_with(
+            &path,
+            &Encoding::NDJSON,
+            &Compression::Gzip { level: 6 },
+            &meta(Some("zeek/conn"), Some("zeek_all")),
+            3,
+        )
+        .await
+        .unwrap();
+
+        let seen = mock.seen.lock().unwrap();
+        assert_eq!(seen.len(), 1);
+        assert_eq!(seen[0].method, "PUT");
+        assert_eq!(
+            seen[0].uri,
+            "/logs/zeek/conn/zeek_all/az-3-01563e3a-b5d3-d676-4c61-efb99302bd5b.ndjson.gz?sv=2021&sig=abc"
+        );
+        assert_eq!(seen[0].headers["x-ms-blob-type"], "BlockBlob");
+        assert_eq!(seen[0].headers["content-encoding"], "gzip");
+        assert_eq!(seen[0].headers["x-ms-version"], API_VERSION);
+        assert_eq!(seen[0].body, b"{\"x\":1}\n");
+    }
+
+    #[tokio::test]
+    async fn failed_uploads_surface_the_status_and_retry_to_the_same_blob() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("01ARZ3NDEKTSV4RRFFQ69G5FAV.bin.sealed");
+        tokio::fs::write(&path, b"{\"x\":1}\n").await.unwrap();
+
+        let mock = Mock::default();
+        mock.statuses
+            .lock()
+            .unwrap()
+            .push_back(StatusCode::SERVICE_UNAVAILABLE);
+        let endpoint = mock_endpoint(&mock).await;
+        let sink = AzureBlobSink::new(
+            Arc::from("az"),
+            &config(Some(endpoint), Some("{sink}/{batch_id}")),
+        )
+        .unwrap();
+
+        let item = S3SinkItem {
+            batch_id: Some(Arc::from("5eed")),
+            ..meta(None, None)
+        };
+        let upload =
+            || sink.write_path_with(&path, &Encoding::NDJSON, &Compression::None, &item, 0);
+        let err = upload().await.unwrap_err();
+        assert!(format!("{err:#}").contains("503 Service Unavailable: ServerBusy"));
+        upload().await.unwrap();
+
+        let seen = mock.seen.lock().unwrap();
+        assert_eq!(seen.len(), 2);
+        assert_eq!(seen[0].uri, seen[1].uri);
+        assert_eq!(seen[0].uri, "/logs/az/5eed.ndjson?sv=2021&sig=abc");
+    }
+
+    #[tokio::test]
+    async fn large_files_upload_as_blocks() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("01ARZ3NDEKTSV4RRFFQ69G5FAV.bin.sealed");
+        tokio::fs::write(&path, b"0123456789").await.unwrap();
+
+        let mock = Mock::default();
+        let endpoint = mock_endpoint(&mock).await;
+        let mut sink = AzureBlobSink::new(Arc::from("az"), &config(Some(endpoint), None)).unwrap();
+        sink.block_size = 4;
+        sink.write_path_with(
+            &path,
+            &Encoding::NDJSON,
+            &Compression::None,
+            &meta(None, None),
+            0,
+        )
+        .await
+        .unwrap();
+
+        let seen = mock.seen.lock().unwrap();
+        let blob = "/logs/01ARZ3NDEKTSV4RRFFQ69G5FAV.ndjson?sv=2021&sig=abc";
+        assert_eq!(seen.len(), 4);
+        for (i, (req, body)) in seen[..3]
+            .iter()
+            .zip([&b"0123"[..], &b"4567"[..], &b"89"[..]])
+            .enumerate()
+        {
+            let id = base64::engine::general_purpose::STANDARD.encode(format!("{i:08}"));
+            assert_eq!(
+                req.uri,
+                format!(
+                    "{blob}&comp=block&blockid={}",
+                    utf8_percent_encode(&id, SEGMENT)
+                )
+            );
+            assert_eq!(req.body, body);
+        }
+        assert_eq!(seen[3].uri, format!("{blob}&comp=blocklist"));
+        assert_eq!(
+            seen[3].headers["x-ms-blob-content-type"],
+            Encoding::content_type(&Encoding::NDJSON)
+        );
+        assert!(String::from_utf8_lossy(&seen[3].body).contains("<Latest>MDAwMDAwMDI=</Latest>"));
+    }
+
+    #[tokio::test]
+    async fn content_type_and_metadata_apply_to_both_upload_paths() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("01ARZ3NDEKTSV4RRFFQ69G5FAV.bin.sealed");
+        tokio::fs::write(&path, b"0123456789").await.unwrap();
+
+        let mock = Mock::default();
+        let mut cfg = config(Some(mock_endpoint(&mock).await), None);
+        cfg.content_type = Some("application/json".into());
+        cfg.object_metadata = BTreeMap::from([
+            ("producer".to_string(), "tangent".to_string()),
+            ("schema".to_string(), "ocsf_1_5".to_string()),
+        ]);
+        let mut sink = AzureBlobSink::new(Arc::from("az"), &cfg).unwrap();
+        let item = meta(None, None);
+
+        for block_size in [1024, 4] {
+            sink.block_size = block_size;
+            sink.write_path_with(&path, &Encoding::NDJSON, &Compression::None, &item, 0)
+                .await
+                .unwrap();
+        }
+
+        let seen = mock.seen.lock().unwrap();
+        let (put, commit) = (&seen[0], seen.last().unwrap());
+        assert_eq!(put.headers["content-type"], "application/json");
+        assert_eq!(commit.headers["x-ms-blob-content-type"], "application/json");
+        for req in [put, commit] {
+            assert_eq!(req.headers["x-ms-meta-producer"], "tangent");
+            assert_eq!(req.headers["x-ms-meta-schema"], "ocsf_1_5");
+        }
+        // Blocks are staged without properties; the commit sets them.
+        assert!(!seen[1].headers.contains_key("x-ms-meta-producer"));
+    }
+
+    #[test]
+    fn rejects_invalid_metadata_names() {
+        let mut cfg = config(None, None);
+        cfg.object_metadata = BTreeMap::from([("ocsf-version".to_string(), "1.5".to_string())]);
+        let err = AzureBlobSink::new(Arc::from("az"), &cfg).err().unwrap();
+        assert!(err
+            .to_string()
+            .contains(r#"object_metadata name "ocsf-version""#));
+    }
+}
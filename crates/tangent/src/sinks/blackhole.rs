@@ -4,7 +4,8 @@ use std::sync::Arc;
 
 use crate::{
     sinks::manager::{Sink, SinkWrite},
-    SINK_BYTES_TOTAL, SINK_BYTES_UNCOMPRESSED_TOTAL, SINK_OBJECTS_TOTAL,
+    BLACKHOLE_BYTES_TOTAL, BLACKHOLE_RECORDS_TOTAL, SINK_BYTES_TOTAL,
+    SINK_BYTES_UNCOMPRESSED_TOTAL, SINK_OBJECTS_TOTAL,
 };
 
 #[derive(Default)]
@@ -23,6 +24,19 @@ impl Sink for BlackholeSink {
         SINK_BYTES_TOTAL.inc_by(req.payload.len() as u64);
         SINK_BYTES_UNCOMPRESSED_TOTAL.inc_by(req.payload.len() as u64);
 
+        // Per-sink drop counts, so a blackhole fed by a noise selector shows
+        // how much it is actually discarding.
+        let records = req.payload[..]
+            .split(|b| *b == b'\n')
+            .filter(|l| !l.is_empty())
+            .count();
+        BLACKHOLE_RECORDS_TOTAL
+            .with_label_values(&[&req.sink_name])
+            .inc_by(records as u64);
+        BLACKHOLE_BYTES_TOTAL
+            .with_label_values(&[&req.sink_name])
+            .inc_by(req.payload.len() as u64);
+
         Ok(())
     }
 }
@@ -8,7 +8,7 @@ use parquet::basic::{Compression as PqCompression, GzipLevel, ZstdLevel};
 use parquet::{arrow::ArrowWriter, file::properties::WriterProperties};
 use std::io::Cursor;
 use std::sync::Arc;
-use tangent_shared::sinks::common::{Compression, Encoding};
+use tangent_shared::sinks::common::{ColumnSpec, Compression, Encoding};
 
 #[must_use]
 pub fn ndjson_ensure_newline(mut raw: BytesMut) -> BytesMut {
@@ -44,6 +44,8 @@ pub fn normalize_from_ndjson(
         Encoding::JSON => ndjson_to_json_array(&raw),
         Encoding::Avro { schema: s } => ndjson_to_avro(&raw, s, comp),
         Encoding::Parquet { schema: s } => ndjson_to_parquet(&raw, s, comp),
+        Encoding::Csv { columns } => ndjson_to_delimited(&raw, columns, Delimited::Csv, true),
+        Encoding::Tsv { columns } => ndjson_to_delimited(&raw, columns, Delimited::Tsv, true),
     }
 }
 
@@ -51,6 +53,93 @@ fn ndjson_iter_lines(raw: &[u8]) -> impl Iterator<Item = &[u8]> {
     raw.split(|&b| b == b'\n').filter(|line| !line.is_empty())
 }
 
+#[derive(Clone, Copy)]
+pub enum Delimited {
+    Csv,
+    Tsv,
+}
+
+/// Writes one row per record, after a header row when `header` is set.
+/// Missing or null fields take the column default; objects and arrays are
+/// written as JSON text.
+pub fn ndjson_to_delimited(
+    raw: &[u8],
+    columns: &[ColumnSpec],
+    kind: Delimited,
+    header: bool,
+) -> Result<BytesMut> {
+    let paths: Vec<Vec<&str>> = columns
+        .iter()
+        .map(|c| c.path.split('.').collect())
+        .collect();
+
+    let mut out = BytesMut::new();
+    if header {
+        write_row(
+            &mut out,
+            kind,
+            columns.iter().map(|c| c.header.as_str().into()),
+        );
+    }
+
+    for line in ndjson_iter_lines(raw) {
+        let record: serde_json::Value = serde_json::from_slice(line)?;
+        write_row(
+            &mut out,
+            kind,
+            paths.iter().zip(columns).map(|(path, col)| {
+                match path.iter().try_fold(&record, |v, seg| v.get(*seg)) {
+                    None | Some(serde_json::Value::Null) => col.default.as_str().into(),
+                    Some(serde_json::Value::String(s)) => s.as_str().into(),
+                    Some(other) => other.to_string().into(),
+                }
+            }),
+        );
+    }
+    Ok(out)
+}
+
+fn write_row<'a>(
+    out: &mut BytesMut,
+    kind: Delimited,
+    cells: impl Iterator<Item = std::borrow::Cow<'a, str>>,
+) {
+    for (i, cell) in cells.enumerate() {
+        match kind {
+            Delimited::Csv => {
+                if i > 0 {
+                    out.put_u8(b',');
+                }
+                if cell.contains([',', '"', '\n', '\r']) {
+                    out.put_u8(b'"');
+                    out.put_slice(cell.replace('"', "\"\"").as_bytes());
+                    out.put_u8(b'"');
+                } else {
+                    out.put_slice(cell.as_bytes());
+                }
+            }
+            Delimited::Tsv => {
+                if i > 0 {
+                    out.put_u8(b'\t');
+                }
+                for c in cell.chars() {
+                    match c {
+                        '\\' => out.put_slice(b"\\\\"),
+                        '\t' => out.put_slice(b"\\t"),
+                        '\n' => out.put_slice(b"\\n"),
+                        '\r' => out.put_slice(b"\\r"),
+                        c => out.put_slice(c.encode_utf8(&mut [0; 4]).as_bytes()),
+                    }
+                }
+            }
+        }
+    }
+    out.put_slice(match kind {
+        Delimited::Csv => b"\r\n",
+        Delimited::Tsv => b"\n",
+    });
+}
+
 pub fn ndjson_to_avro(raw: &[u8], avro_schema_json: &str, comp: &Compression) -> Result<BytesMut> {
     let codec = avro_codec_from(comp);
     let schema = apache_avro::Schema::parse_str(avro_schema_json)?;
@@ -168,3 +257,70 @@ pub fn ndjson_chunk_slices(buf: Bytes, max_chunk: usize) -> Vec<Bytes> {
     }
     chunks
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn col(path: &str) -> ColumnSpec {
+        ColumnSpec {
+            header: path.to_string(),
+            path: path.to_string(),
+            default: String::new(),
+        }
+    }
+
+    #[test]
+    fn csv_quotes_and_fills_missing_columns() {
+        let raw = br#"{"src":{"ip":"10.0.0.1"},"msg":"a, \"b\""}
+{"msg":"plain","tags":["x"]}
+"#;
+        let cols = vec![col("src.ip"), col("msg"), col("tags")];
+        let out = ndjson_to_delimited(raw, &cols, Delimited::Csv, true).unwrap();
+        assert_eq!(
+            std::str::from_utf8(&out).unwrap(),
+            "src.ip,msg,tags\r\n10.0.0.1,\"a, \"\"b\"\"\",\r\n,plain,\"[\"\"x\"\"]\"\r\n"
+        );
+    }
+
+    #[test]
+    fn csv_quotes_newlines_and_uses_defaults() {
+        let raw = br#"{"msg":"line1\nline2"}
+"#;
+        let cols = vec![
+            ColumnSpec {
+                header: "Message".into(),
+                path: "msg".into(),
+                default: String::new(),
+            },
+            ColumnSpec {
+                header: "Host".into(),
+                path: "host.name".into(),
+                default: "-".into(),
+            },
+        ];
+        let out = ndjson_to_delimited(raw, &cols, Delimited::Csv, true).unwrap();
+        assert_eq!(
+            std::str::from_utf8(&out).unwrap(),
+            "Message,Host\r\n\"line1\nline2\",-\r\n"
+        );
+    }
+
+    #[test]
+    fn tsv_escapes_tabs_newlines_and_backslashes() {
+        let raw = br#"{"a":"x\ty","b":"p\\q\nr","c":"say \"hi\""}
+"#;
+        let cols = vec![col("a"), col("b"), col("c"), col("d")];
+        let out = ndjson_to_delimited(raw, &cols, Delimited::Tsv, true).unwrap();
+        assert_eq!(
+            std::str::from_utf8(&out).unwrap(),
+            "a\tb\tc\td\nx\\ty\tp\\\\q\\nr\tsay \"hi\"\t\n"
+        );
+    }
+
+    #[test]
+    fn json_array_of_nothing_is_empty_array() {
+        let out = ndjson_to_json_array(b"").unwrap();
+        assert_eq!(&out[..], b"[]");
+    }
+}
@@ -8,7 +8,7 @@ use tokio::fs::{self, OpenOptions};
 use tokio::io::AsyncWriteExt;
 use tokio::sync::Mutex;
 
-use crate::sinks::encoding;
+use crate::sinks::encoding::{self, Delimited};
 use crate::sinks::manager::{Sink, SinkWrite};
 use crate::{SINK_BYTES_TOTAL, SINK_BYTES_UNCOMPRESSED_TOTAL, SINK_OBJECTS_TOTAL};
 
@@ -20,7 +20,14 @@ pub struct FileSink {
     path: PathBuf,
     encoding: Encoding,
     compression: Compression,
-    file: Mutex<tokio::fs::File>,
+    out: Mutex<Output>,
+}
+
+struct Output {
+    file: tokio::fs::File,
+    /// CSV and TSV files get their header row once, on the first write to an
+    /// empty file; later writes, including after a restart, append rows.
+    needs_header: bool,
 }
 
 impl FileSink {
@@ -36,12 +43,13 @@ impl FileSink {
             .append(true)
             .open(&path)
             .await?;
+        let needs_header = file.metadata().await?.len() == 0;
 
         Ok(Arc::new(Self {
             path,
             encoding: common.encoding.clone(),
             compression: common.compression.clone(),
-            file: Mutex::new(file),
+            out: Mutex::new(Output { file, needs_header }),
         }))
     }
 
@@ -54,14 +62,25 @@ impl FileSink {
 impl Sink for FileSink {
     async fn write(&self, req: SinkWrite) -> Result<()> {
         let uncompressed_bytes = req.payload.len();
-        let normalized_payload =
-            encoding::normalize_from_ndjson(&self.encoding, &self.compression, req.payload)?;
+        let mut out = self.out.lock().await;
+        let normalized_payload = match &self.encoding {
+            Encoding::Csv { columns } => encoding::ndjson_to_delimited(
+                &req.payload,
+                columns,
+                Delimited::Csv,
+                out.needs_header,
+            )?,
+            Encoding::Tsv { columns } => encoding::ndjson_to_delimited(
+                &req.payload,
+                columns,
+                Delimited::Tsv,
+                out.needs_header,
+            )?,
+            _ => encoding::normalize_from_ndjson(&self.encoding, &self.compression, req.payload)?,
+        };
 
-        self.file
-            .lock()
-            .await
-            .write_all(&normalized_payload)
-            .await?;
+        out.file.write_all(&normalized_payload).await?;
+        out.needs_header = false;
 
         SINK_OBJECTS_TOTAL.inc();
         SINK_BYTES_TOTAL.inc_by(normalized_payload.len() as u64);
@@ -70,7 +89,88 @@ impl Sink for FileSink {
     }
 
     async fn flush(&self) -> Result<()> {
-        self.file.lock().await.sync_data().await?;
+        self.out.lock().await.file.sync_data().await?;
         Ok(())
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use bytes::BytesMut;
+    use tangent_shared::sinks::common::ColumnSpec;
+
+    fn columns() -> Vec<ColumnSpec> {
+        ["src.ip", "msg"]
+            .map(|p| ColumnSpec {
+                header: p.to_string(),
+                path: p.to_string(),
+                default: String::new(),
+            })
+            .to_vec()
+    }
+
+    async fn open(path: &Path, encoding: Encoding) -> Arc<FileSink> {
+        FileSink::new(
+            &FileConfig {
+                path: path.to_path_buf(),
+            },
+            &CommonSinkOptions {
+                compression: Compression::None,
+                encoding,
+                object_max_bytes: 0,
+                in_flight_limit: 1,
+                default: false,
+            },
+        )
+        .await
+        .unwrap()
+    }
+
+    async fn write(sink: &FileSink, line: &str) {
+        sink.write(SinkWrite {
+            sink_name: Arc::from("csv"),
+            payload: BytesMut::from(line),
+            s3: None,
+        })
+        .await
+        .unwrap();
+    }
+
+    #[tokio::test]
+    async fn csv_header_is_written_once_per_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("out.csv");
+
+        let sink = open(&path, Encoding::Csv { columns: columns() }).await;
+        write(&sink, "{\"src\":{\"ip\":\"10.0.0.1\"},\"msg\":\"a\"}\n").await;
+        write(&sink, "{\"msg\":\"b\"}\n").await;
+        sink.flush().await.unwrap();
+        drop(sink);
+
+        let reopened = open(&path, Encoding::Csv { columns: columns() }).await;
+        write(&reopened, "{\"msg\":\"c\"}\n").await;
+        reopened.flush().await.unwrap();
+
+        assert_eq!(
+            fs::read_to_string(&path).await.unwrap(),
+            "src.ip,msg\r\n10.0.0.1,a\r\n,b\r\n,c\r\n"
+        );
+    }
+
+    #[tokio::test]
+    async fn tsv_header_is_written_once_per_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("out.tsv");
+
+        let sink = open(&path, Encoding::Tsv { columns: columns() }).await;
+        write(&sink, "{\"msg\":\"a\"}\n").await;
+        write(&sink, "{\"msg\":\"b\"}\n").await;
+        sink.flush().await.unwrap();
+
+        assert_eq!(
+            fs::read_to_string(&path).await.unwrap(),
+            "src.ip\tmsg\n\ta\n\tb\n"
+        );
+    }
+}
@@ -0,0 +1,153 @@
+use anyhow::{anyhow, bail, Result};
+use async_trait::async_trait;
+use futures::future::try_join_all;
+use rdkafka::config::ClientConfig;
+use rdkafka::producer::{FutureProducer, FutureRecord};
+use rdkafka::util::Timeout;
+use secrecy::ExposeSecret;
+use serde_json::Value;
+use std::sync::Arc;
+use tangent_shared::sinks::common::{CommonSinkOptions, Compression, Encoding};
+use tangent_shared::sinks::kafka::KafkaConfig;
+use tangent_shared::sources::msk::MSKAuth;
+
+use crate::sinks::manager::{Sink, SinkWrite};
+use crate::{SINK_BYTES_TOTAL, SINK_BYTES_UNCOMPRESSED_TOTAL, SINK_OBJECTS_TOTAL};
+
+/// Publishes each NDJSON record as its own Kafka message. Batching and
+/// compression happen in the producer, per topic.
+pub struct KafkaSink {
+    producer: FutureProducer,
+    topic: String,
+    key_field: Option<Vec<String>>,
+}
+
+impl KafkaSink {
+    pub fn new(cfg: &KafkaConfig, common: &CommonSinkOptions) -> Result<Arc<Self>> {
+        match common.encoding {
+            Encoding::NDJSON | Encoding::JSON => {}
+            _ => bail!("kafka sink only supports ndjson or json encoding"),
+        }
+
+        let compression = match common.compression {
+            Compression::None => "none",
+            Compression::Gzip { .. } => "gzip",
+            Compression::Zstd { .. } => "zstd",
+            Compression::Snappy { .. } => "snappy",
+            Compression::Deflate { .. } => bail!("kafka sink does not support deflate compression"),
+        };
+
+        let mut pc = ClientConfig::new();
+        pc.set("bootstrap.servers", &cfg.bootstrap_servers)
+            .set("security.protocol", cfg.security_protocol.as_str())
+            .set("compression.type", compression)
+            .set("linger.ms", "50");
+
+        if let Some(p) = cfg.ssl_ca_location.as_deref() {
+            pc.set("ssl.ca.location", p);
+        }
+        if let Some(p) = cfg.ssl_certificate_location.as_deref() {
+            pc.set("ssl.certificate.location", p);
+        }
+        if let Some(p) = cfg.ssl_key_location.as_deref() {
+            pc.set("ssl.key.location", p);
+        }
+
+        if let Some(MSKAuth::Scram {
+            sasl_mechanism,
+            username,
+            password,
+        }) = &cfg.auth
+        {
+            pc.set("sasl.mechanism", sasl_mechanism)
+                .set("sasl.username", username)
+                .set("sasl.password", password.expose_secret());
+        }
+
+        let producer: FutureProducer = pc
+            .create()
+            .map_err(|e| anyhow!("creating FutureProducer failed: {e:#?}"))?;
+
+        Ok(Arc::new(Self {
+            producer,
+            topic: cfg.topic.clone(),
+            key_field: cfg
+                .key_field
+                .as_ref()
+                .map(|f| f.split('.').map(str::to_owned).collect()),
+        }))
+    }
+}
+
+/// Looks up a dotted path in a JSON record. Strings are used as-is; other
+/// scalars use their JSON text. Missing or null values yield no key.
+fn record_key(line: &[u8], path: &[String]) -> Option<String> {
+    let record: Value = serde_json::from_slice(line).ok()?;
+    let value = path.iter().try_fold(&record, |v, seg| v.get(seg))?;
+    match value {
+        Value::Null => None,
+        Value::String(s) => Some(s.clone()),
+        other => Some(other.to_string()),
+    }
+}
+
+#[async_trait]
+impl Sink for KafkaSink {
+    async fn write(&self, req: SinkWrite) -> Result<()> {
+        // Slice first: BytesMut has its own split() that takes no predicate.
+        let lines: Vec<&[u8]> = req.payload[..]
+            .split(|b| *b == b'\n')
+            .filter(|l| !l.is_empty())
+            .collect();
+        let keys: Vec<Option<String>> = lines
+            .iter()
+            .map(|l| self.key_field.as_deref().and_then(|p| record_key(l, p)))
+            .collect();
+
+        let sends = lines.iter().zip(&keys).map(|(line, key)| {
+            let mut record = FutureRecord::<str, [u8]>::to(&self.topic).payload(line);
+            if let Some(k) = key {
+                record = record.key(k.as_str());
+            }
+            self.producer.send(record, Timeout::Never)
+        });
+        try_join_all(sends)
+            .await
+            .map_err(|(e, _)| anyhow!("kafka produce to {} failed: {e}", self.topic))?;
+
+        SINK_OBJECTS_TOTAL.inc_by(lines.len() as u64);
+        SINK_BYTES_TOTAL.inc_by(req.payload.len() as u64);
+        SINK_BYTES_UNCOMPRESSED_TOTAL.inc_by(req.payload.len() as u64);
+        Ok(())
+    }
+
+    async fn flush(&self) -> Result<()> {
+        use rdkafka::producer::Producer;
+
+        self.producer
+            .flush(Timeout::After(std::time::Duration::from_secs(30)))
+            .map_err(|e| anyhow!("kafka flush failed: {e}"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::record_key;
+
+    fn path(p: &str) -> Vec<String> {
+        p.split('.').map(str::to_owned).collect()
+    }
+
+    #[test]
+    fn keys_follow_dotted_paths() {
+        let line = br#"{"metadata":{"uid":"abc"},"src_endpoint":{"ip":"10.0.0.1","port":22}}"#;
+
+        assert_eq!(record_key(line, &path("metadata.uid")), Some("abc".into()));
+        assert_eq!(
+            record_key(line, &path("src_endpoint.port")),
+            Some("22".into())
+        );
+        assert_eq!(record_key(line, &path("dst_endpoint.ip")), None);
+        assert_eq!(record_key(b"not json", &path("metadata.uid")), None);
+    }
+}
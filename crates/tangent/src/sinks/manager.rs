@@ -11,8 +11,10 @@ use tokio::sync::{mpsc, OwnedSemaphorePermit, Semaphore};
 use tokio::task::{JoinHandle, JoinSet};
 use tokio::time::{sleep, Instant};
 
+use crate::sinks::azure_blob;
 use crate::sinks::blackhole;
 use crate::sinks::file;
+use crate::sinks::kafka;
 use crate::sinks::s3::S3SinkItem;
 use crate::INFLIGHT;
 use crate::{
@@ -33,6 +35,12 @@ pub trait Sink: Send + Sync {
     async fn flush(&self) -> Result<()> {
         Ok(())
     }
+
+    /// Whether writes that carry a batch id are named by it, so producers
+    /// know to compute one.
+    fn uses_batch_id(&self) -> bool {
+        false
+    }
 }
 
 pub struct SinkItem {
@@ -71,7 +79,16 @@ impl SinkManager {
             match &cfg.kind {
                 SinkKind::S3(s3cfg) => {
                     let bucket: Arc<str> = Arc::<str>::from(s3cfg.bucket_name.clone());
-                    let remote = Arc::new(s3::S3Sink::new(Arc::clone(&name), bucket).await?);
+                    let remote = Arc::new(
+                        s3::S3Sink::new(
+                            Arc::clone(&name),
+                            bucket,
+                            s3cfg.key_template.as_deref(),
+                            s3cfg.content_type.clone(),
+                            &s3cfg.object_metadata,
+                        )
+                        .await?,
+                    );
                     let s3_sink = wal::DurableFileSink::new(
                         remote,
                         s3cfg.wal_path.clone(),
@@ -90,10 +107,38 @@ impl SinkManager {
                         },
                     );
                 }
+                SinkKind::AzureBlob(azcfg) => {
+                    let container: Arc<str> = Arc::<str>::from(azcfg.container.clone());
+                    let remote =
+                        Arc::new(azure_blob::AzureBlobSink::new(Arc::clone(&name), azcfg)?);
+                    let az_sink = wal::DurableFileSink::new(
+                        remote,
+                        azcfg.wal_path.clone(),
+                        cfg.common.in_flight_limit,
+                        cfg.common.object_max_bytes,
+                        Duration::from_secs(azcfg.max_file_age_seconds),
+                        cfg.common.compression.clone(),
+                        cfg.common.encoding.clone(),
+                    )
+                    .await?;
+                    // Same WAL-backed, prefix-keyed path as S3; the container
+                    // stands in for the bucket.
+                    sinks.insert(
+                        Arc::clone(&name),
+                        SinkEntry::S3 {
+                            sink: az_sink as Arc<dyn Sink>,
+                            bucket: container,
+                        },
+                    );
+                }
                 SinkKind::File(filecfg) => {
                     let file_sink = file::FileSink::new(filecfg, &cfg.common).await?;
                     sinks.insert(Arc::clone(&name), SinkEntry::Other { sink: file_sink });
                 }
+                SinkKind::Kafka(kafkacfg) => {
+                    let kafka_sink = kafka::KafkaSink::new(kafkacfg, &cfg.common)?;
+                    sinks.insert(Arc::clone(&name), SinkEntry::Other { sink: kafka_sink });
+                }
                 SinkKind::Blackhole(_) => {
                     let bh = blackhole::BlackholeSink::new();
                     sinks.insert(Arc::clone(&name), SinkEntry::Other { sink: bh });
@@ -135,10 +180,17 @@ impl SinkManager {
                             };
 
                             if let SinkEntry::S3 { bucket, .. } = entry {
-                                let prefix = item.req.s3.as_ref().and_then(|m| m.key_prefix.clone());
+                                let (prefix, module, batch_id) = item
+                                    .req
+                                    .s3
+                                    .take()
+                                    .map(|m| (m.key_prefix, m.module, m.batch_id))
+                                    .unwrap_or_default();
                                 item.req.s3 = Some(s3::S3SinkItem {
                                     bucket_name: bucket.clone(),
                                     key_prefix: prefix,
+                                    module,
+                                    batch_id,
                                 });
                             } else {
                                 item.req.s3 = None;
@@ -214,10 +266,42 @@ impl SinkManager {
         Self::from_entries(entries, total_inflight)
     }
 
+    /// Like `for_test`, but the sinks receive key prefixes as S3-style sinks
+    /// do, each standing in for a bucket of its own name.
+    #[cfg(test)]
+    pub(crate) fn for_test_prefixed(
+        sinks: Vec<(Arc<str>, Arc<dyn Sink>)>,
+        total_inflight: usize,
+    ) -> Self {
+        let entries = sinks
+            .into_iter()
+            .map(|(name, sink)| {
+                let bucket = name.clone();
+                (name, SinkEntry::S3 { sink, bucket })
+            })
+            .collect();
+        Self::from_entries(entries, total_inflight)
+    }
+
+    /// Whether the named sink wants batch ids; see [`Sink::uses_batch_id`].
+    pub fn uses_batch_id(&self, sink_name: &str) -> bool {
+        match self.sinks.get(sink_name) {
+            Some(SinkEntry::S3 { sink, .. }) | Some(SinkEntry::Other { sink }) => {
+                sink.uses_batch_id()
+            }
+            None => false,
+        }
+    }
+
+    /// Queues `payload` for a sink. `module` names the plugin that produced
+    /// it and `batch_id` the input batch it came from, for object key
+    /// templates; output straight from a source has neither.
     pub async fn enqueue(
         &self,
         sink_name: Arc<str>,
         key_prefix: Option<Arc<str>>,
+        module: Option<Arc<str>>,
+        batch_id: Option<Arc<str>>,
         payload: BytesMut,
         acks: Vec<Arc<dyn Ack>>,
     ) -> Result<()> {
@@ -241,9 +325,11 @@ impl SinkManager {
             req: SinkWrite {
                 sink_name: Arc::<str>::from(sink_name),
                 payload: payload,
-                s3: key_prefix.clone().map(|kp| s3::S3SinkItem {
+                s3: (key_prefix.is_some() || module.is_some()).then(|| s3::S3SinkItem {
                     bucket_name: Arc::<str>::from(""), // placeholder; filled in shard
-                    key_prefix: Some(kp),
+                    key_prefix,
+                    module,
+                    batch_id,
                 }),
             },
         };
@@ -349,6 +435,8 @@ mod tests {
             .enqueue(
                 sink_name.clone(),
                 None,
+                None,
+                None,
                 BytesMut::from("{\"msg\":1}\n"),
                 vec![ack_dyn],
             )
@@ -359,6 +447,8 @@ mod tests {
             .enqueue(
                 sink_name.clone(),
                 None,
+                None,
+                None,
                 BytesMut::from("{\"msg\":2}\n"),
                 Vec::new(),
             )
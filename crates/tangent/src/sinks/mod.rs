@@ -1,6 +1,9 @@
+pub mod azure_blob;
 pub mod blackhole;
 pub mod encoding;
 pub mod file;
+pub mod kafka;
 pub mod manager;
+pub mod prefix;
 pub mod s3;
 pub mod wal;
@@ -0,0 +1,222 @@
+use anyhow::{bail, Result};
+use chrono::format::{Item, StrftimeItems};
+use chrono::{DateTime, Utc};
+use serde::Deserialize;
+use serde_json::Value;
+
+/// Partition value used when a record lacks a field the template references.
+pub const DEFAULT_UNKNOWN_PARTITION: &str = "__unknown__";
+
+/// Distinct prefixes a sink edge renders before the rest overflow into the
+/// unknown partition.
+pub const DEFAULT_MAX_PARTITIONS: usize = 1000;
+
+/// A sink key prefix with per-record placeholders, e.g.
+/// `cloudtrail/region={cloud.region}/dt={time:%Y-%m-%d}/`.
+///
+/// `{a.b}` is a dotted path into the record. `{time:FMT}` formats the record's
+/// `time` field (epoch milliseconds or an RFC 3339 string) with chrono's
+/// strftime syntax. Field values are sanitized so they can't add path
+/// segments: `/` becomes `_`, and empty, `.` and `..` values render as the
+/// unknown partition.
+#[derive(Debug, Clone, PartialEq)]
+pub struct PrefixTemplate {
+    parts: Vec<Part>,
+    has_fields: bool,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Part {
+    Lit(String),
+    Field(Vec<String>),
+    Time(String),
+}
+
+impl PrefixTemplate {
+    /// Returns `None` when `s` has no placeholders and can be used verbatim.
+    /// An unclosed `{` is kept as literal text. Errors on a `{time:FMT}` that
+    /// chrono can't format.
+    pub fn parse(s: &str) -> Result<Option<Self>> {
+        let mut parts = Vec::new();
+        let mut rest = s;
+
+        while let Some(open) = rest.find('{') {
+            let Some(close) = rest[open..].find('}').map(|c| open + c) else {
+                break;
+            };
+            if open > 0 {
+                parts.push(Part::Lit(rest[..open].to_string()));
+            }
+            let inner = rest[open + 1..close].trim();
+            parts.push(match inner.strip_prefix("time:") {
+                Some(fmt) => {
+                    if StrftimeItems::new(fmt).any(|i| matches!(i, Item::Error)) {
+                        bail!("invalid time format {fmt:?} in key prefix {s:?}");
+                    }
+                    Part::Time(fmt.to_string())
+                }
+                None => Part::Field(inner.split('.').map(str::to_owned).collect()),
+            });
+            rest = &rest[close + 1..];
+        }
+
+        if parts.is_empty() {
+            return Ok(None);
+        }
+        if !rest.is_empty() {
+            parts.push(Part::Lit(rest.to_string()));
+        }
+        let has_fields = parts.iter().any(|p| matches!(p, Part::Field(_)));
+        Ok(Some(Self { parts, has_fields }))
+    }
+
+    /// Parses what `render` needs from an NDJSON line. A template that only
+    /// formats the time reads just the `time` field rather than building the
+    /// whole record. Lines that aren't JSON objects parse as `Null`.
+    pub fn record(&self, line: &[u8]) -> Value {
+        if self.has_fields {
+            return serde_json::from_slice(line).unwrap_or(Value::Null);
+        }
+
+        #[derive(Deserialize)]
+        struct Timed {
+            #[serde(default)]
+            time: Value,
+        }
+        match serde_json::from_slice::<Timed>(line) {
+            Ok(t) => Value::Object([("time".to_string(), t.time)].into_iter().collect()),
+            Err(_) => Value::Null,
+        }
+    }
+
+    pub fn render(&self, record: &Value, unknown: &str) -> String {
+        let mut out = String::new();
+        for part in &self.parts {
+            match part {
+                Part::Lit(s) => out.push_str(s),
+                Part::Field(path) => match lookup(record, path) {
+                    Some(Value::String(s)) => match segment(s) {
+                        Some(seg) => out.push_str(&seg),
+                        None => out.push_str(unknown),
+                    },
+                    Some(v @ (Value::Number(_) | Value::Bool(_))) => out.push_str(&v.to_string()),
+                    _ => out.push_str(unknown),
+                },
+                Part::Time(fmt) => match event_time(record) {
+                    Some(t) => out.push_str(&t.format(fmt).to_string()),
+                    None => out.push_str(unknown),
+                },
+            }
+        }
+        out
+    }
+}
+
+/// Makes a field value safe as one key segment, or `None` if it can't be.
+fn segment(s: &str) -> Option<String> {
+    let seg = s.replace('/', "_");
+    match seg.as_str() {
+        "" | "." | ".." => None,
+        _ => Some(seg),
+    }
+}
+
+fn lookup<'a>(record: &'a Value, path: &[String]) -> Option<&'a Value> {
+    path.iter().try_fold(record, |v, seg| v.get(seg))
+}
+
+fn event_time(record: &Value) -> Option<DateTime<Utc>> {
+    match record.get("time")? {
+        Value::Number(n) => DateTime::from_timestamp_millis(n.as_i64()?),
+        Value::String(s) => DateTime::parse_from_rfc3339(s)
+            .ok()
+            .map(|t| t.with_timezone(&Utc)),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    #[test]
+    fn renders_fields_and_time() {
+        let tpl = PrefixTemplate::parse("cloudtrail/region={cloud.region}/dt={time:%Y-%m-%d}/")
+            .unwrap()
+            .unwrap();
+
+        let rec = json!({"cloud": {"region": "us-east-1"}, "time": 1717200000000i64});
+        assert_eq!(
+            tpl.render(&rec, DEFAULT_UNKNOWN_PARTITION),
+            "cloudtrail/region=us-east-1/dt=2024-06-01/"
+        );
+
+        let rec = json!({"time": "2024-06-01T23:59:59Z"});
+        assert_eq!(
+            tpl.render(&rec, "none"),
+            "cloudtrail/region=none/dt=2024-06-01/"
+        );
+    }
+
+    #[test]
+    fn routes_zeek_logs_by_log_name() {
+        let tpl = PrefixTemplate::parse("zeek/{metadata.log_name}/")
+            .unwrap()
+            .unwrap();
+
+        let conn = json!({"class_uid": 4001, "metadata": {"log_name": "conn"}});
+        let dns = json!({"class_uid": 4003, "metadata": {"log_name": "dns"}});
+        let http = json!({"_path": "http", "uid": "CmRFd61N7G7YA909D1"});
+        assert_eq!(tpl.render(&conn, "unmapped"), "zeek/conn/");
+        assert_eq!(tpl.render(&dns, "unmapped"), "zeek/dns/");
+        assert_eq!(tpl.render(&http, "unmapped"), "zeek/unmapped/");
+    }
+
+    #[test]
+    fn plain_prefixes_are_not_templates() {
+        assert_eq!(PrefixTemplate::parse("cloudtrail/").unwrap(), None);
+        assert_eq!(PrefixTemplate::parse("odd{/").unwrap(), None);
+    }
+
+    #[test]
+    fn rejects_bad_time_formats() {
+        let err = PrefixTemplate::parse("dt={time:%Y-%Q}/").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            r#"invalid time format "%Y-%Q" in key prefix "dt={time:%Y-%Q}/""#
+        );
+        assert!(PrefixTemplate::parse("dt={time:%}/").is_err());
+        assert!(PrefixTemplate::parse("dt={time:%Y/%m/%d/%H}/").is_ok());
+    }
+
+    #[test]
+    fn field_values_stay_in_their_segment() {
+        let tpl = PrefixTemplate::parse("logs/{src}/").unwrap().unwrap();
+        for (src, want) in [
+            ("../../etc", "logs/.._.._etc/"),
+            ("a/b", "logs/a_b/"),
+            ("..", "logs/unknown/"),
+            (".", "logs/unknown/"),
+            ("", "logs/unknown/"),
+            ("/", "logs/_/"),
+        ] {
+            assert_eq!(tpl.render(&json!({"src": src}), "unknown"), want, "{src}");
+        }
+    }
+
+    #[test]
+    fn time_only_templates_read_just_the_time() {
+        let tpl = PrefixTemplate::parse("dt={time:%Y-%m-%d}/")
+            .unwrap()
+            .unwrap();
+        let line = br#"{"time":1717200000000,"src":"10.0.0.1","tags":["a"]}"#;
+        assert_eq!(tpl.record(line), json!({"time": 1717200000000i64}));
+        assert_eq!(tpl.render(&tpl.record(line), "unknown"), "dt=2024-06-01/");
+        assert_eq!(tpl.record(br#"{"src":"x"}"#), json!({"time": null}));
+        assert_eq!(tpl.record(b"not json"), Value::Null);
+
+        let tpl = PrefixTemplate::parse("logs/{src}/").unwrap().unwrap();
+        assert_eq!(tpl.record(line)["tags"], json!(["a"]));
+    }
+}
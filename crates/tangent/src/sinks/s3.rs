@@ -4,12 +4,16 @@ use aws_sdk_s3::types::{CompletedMultipartUpload, CompletedPart};
 use aws_sdk_s3::Client;
 use aws_smithy_runtime_api::client::result::SdkError;
 use aws_smithy_types::byte_stream::ByteStream;
+use chrono::format::{Item, StrftimeItems};
+use chrono::{DateTime, Utc};
+use std::collections::{BTreeMap, HashMap};
 use std::path::Path;
 use std::sync::Arc;
 use tangent_shared::sinks::common::{Compression, Encoding};
 use tokio::fs::File;
 use tokio::io::AsyncReadExt;
 
+use crate::sinks::prefix::DEFAULT_UNKNOWN_PARTITION;
 use crate::sinks::wal::{base_for, WALSink};
 
 pub struct S3Sink {
@@ -17,6 +21,9 @@ pub struct S3Sink {
     client: Client,
     bucket_name: Arc<str>,
     part_size: usize,
+    key_template: Option<KeyTemplate>,
+    content_type: Option<String>,
+    metadata: Option<HashMap<String, String>>,
 }
 
 #[derive(Clone)]
@@ -24,6 +31,11 @@ pub struct S3Sink {
 pub struct S3SinkItem {
     pub bucket_name: Arc<str>,
     pub key_prefix: Option<Arc<str>>,
+    /// Plugin whose output this is, for `{module}` in key templates.
+    pub module: Option<Arc<str>>,
+    /// Fingerprint of the plugin input batch this is the output of, for
+    /// `{batch_id}` in key templates. See [`crate::worker::batch_id`].
+    pub batch_id: Option<Arc<str>>,
 }
 
 #[async_trait]
@@ -34,10 +46,15 @@ impl WALSink for S3Sink {
         encoding: &Encoding,
         compression: &Compression,
         meta: &S3SinkItem,
+        seq: u64,
     ) -> Result<()> {
-        let key = object_key_from(path, meta.key_prefix.as_deref(), encoding, compression);
+        let stem = render_stem(self.key_template.as_ref(), &self.name, meta, path, seq);
+        let key = object_key_from(&stem, meta.key_prefix.as_deref(), encoding, compression);
 
-        let content_type = Encoding::content_type(encoding);
+        let content_type = self
+            .content_type
+            .as_deref()
+            .unwrap_or_else(|| Encoding::content_type(encoding));
         let content_encoding = match compression {
             Compression::None => None,
             Compression::Gzip { .. } => Some("gzip"),
@@ -55,6 +72,7 @@ impl WALSink for S3Sink {
                 .bucket(self.bucket_name.as_ref())
                 .key(&key)
                 .content_type(content_type)
+                .set_metadata(self.metadata.clone())
                 .body(ByteStream::from_path(path).await?);
 
             if let Some(enc) = content_encoding {
@@ -83,7 +101,8 @@ impl WALSink for S3Sink {
             .create_multipart_upload()
             .bucket(self.bucket_name.as_ref())
             .key(&key)
-            .content_type(content_type);
+            .content_type(content_type)
+            .set_metadata(self.metadata.clone());
 
         if let Some(enc) = content_encoding {
             create = create.content_encoding(enc);
@@ -201,10 +220,27 @@ impl WALSink for S3Sink {
         tracing::info!("upload completed {} to {}", key, self.bucket_name);
         Ok(())
     }
+
+    fn uses_batch_id(&self) -> bool {
+        self.key_template
+            .as_ref()
+            .is_some_and(KeyTemplate::uses_batch_id)
+    }
 }
 
 impl S3Sink {
-    pub async fn new(name: Arc<str>, bucket_name: Arc<str>) -> Result<Self> {
+    pub async fn new(
+        name: Arc<str>,
+        bucket_name: Arc<str>,
+        key_template: Option<&str>,
+        content_type: Option<String>,
+        object_metadata: &BTreeMap<String, String>,
+    ) -> Result<Self> {
+        let key_template = key_template
+            .map(KeyTemplate::parse)
+            .transpose()
+            .with_context(|| format!("sink {name}: key_template"))?;
+
         let aws_cfg = aws_config::load_defaults(aws_config::BehaviorVersion::latest()).await;
         let client = Client::new(&aws_cfg);
 
@@ -213,21 +249,172 @@ impl S3Sink {
             client,
             bucket_name: bucket_name,
             part_size: 8 * 1024 * 1024,
+            key_template,
+            content_type,
+            metadata: (!object_metadata.is_empty())
+                .then(|| object_metadata.clone().into_iter().collect()),
         })
     }
 }
 
-fn object_key_from(
-    local_path: &Path,
+/// Object file name template for an S3 sink. See `S3Config::key_template`.
+#[derive(Debug, Clone, PartialEq)]
+pub(crate) struct KeyTemplate {
+    parts: Vec<KeyPart>,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum KeyPart {
+    Lit(String),
+    Sink,
+    Module,
+    Time(String),
+    Uuid,
+    Seq,
+    BatchId,
+}
+
+impl KeyTemplate {
+    pub(crate) fn parse(s: &str) -> Result<Self> {
+        let mut parts = Vec::new();
+        let mut rest = s;
+
+        while let Some(open) = rest.find('{') {
+            let Some(close) = rest[open..].find('}').map(|c| open + c) else {
+                bail!("unclosed '{{' in {s:?}");
+            };
+            if open > 0 {
+                parts.push(KeyPart::Lit(rest[..open].to_string()));
+            }
+            let inner = rest[open + 1..close].trim();
+            parts.push(match inner {
+                "sink" => KeyPart::Sink,
+                "module" => KeyPart::Module,
+                "uuid" => KeyPart::Uuid,
+                "seq" => KeyPart::Seq,
+                "batch_id" => KeyPart::BatchId,
+                _ => match inner.strip_prefix("time:") {
+                    Some(fmt) => {
+                        if StrftimeItems::new(fmt).any(|i| matches!(i, Item::Error)) {
+                            bail!("invalid time format {fmt:?} in {s:?}");
+                        }
+                        KeyPart::Time(fmt.to_string())
+                    }
+                    None => bail!(
+                        "unknown placeholder {{{inner}}} in {s:?}; expected {{sink}}, \
+                         {{module}}, {{time:FMT}}, {{uuid}}, {{seq}} or {{batch_id}}"
+                    ),
+                },
+            });
+            rest = &rest[close + 1..];
+        }
+        if !rest.is_empty() {
+            parts.push(KeyPart::Lit(rest.to_string()));
+        }
+        if parts.is_empty() {
+            bail!("empty key template");
+        }
+        // {seq} restarts with a fresh WAL dir and the rest repeat outright,
+        // so only these keep one batch from overwriting another.
+        if !parts
+            .iter()
+            .any(|p| matches!(p, KeyPart::Uuid | KeyPart::BatchId))
+        {
+            bail!("{s:?} needs {{uuid}} or {{batch_id}} so objects don't overwrite each other");
+        }
+        Ok(Self { parts })
+    }
+
+    pub(crate) fn uses_batch_id(&self) -> bool {
+        self.parts.contains(&KeyPart::BatchId)
+    }
+
+    /// `id` is the WAL file's ULID, which carries the batch start time and
+    /// stays the same across upload retries, as does `seq`, which is fixed
+    /// when the file is opened. `module` is missing for output that came
+    /// straight from a source, and `batch_id` for anything that isn't the
+    /// output of one plugin batch; `{batch_id}` falls back to `id` then.
+    pub(crate) fn render(
+        &self,
+        sink: &str,
+        module: Option<&str>,
+        id: &str,
+        seq: u64,
+        batch_id: Option<&str>,
+    ) -> String {
+        let ulid = ulid::Ulid::from_string(id).ok();
+        let mut out = String::new();
+        for part in &self.parts {
+            match part {
+                KeyPart::Lit(s) => out.push_str(s),
+                KeyPart::Sink => out.push_str(sink),
+                KeyPart::Module => out.push_str(module.unwrap_or(DEFAULT_UNKNOWN_PARTITION)),
+                KeyPart::Time(fmt) => {
+                    let start = ulid
+                        .and_then(|u| {
+                            DateTime::<Utc>::from_timestamp_millis(u.timestamp_ms() as i64)
+                        })
+                        .unwrap_or_else(Utc::now);
+                    out.push_str(&start.format(fmt).to_string());
+                }
+                KeyPart::Uuid => match ulid {
+                    Some(u) => out.push_str(&uuid_string(u128::from(u))),
+                    None => out.push_str(id),
+                },
+                KeyPart::Seq => out.push_str(&seq.to_string()),
+                KeyPart::BatchId => out.push_str(batch_id.unwrap_or(id)),
+            }
+        }
+        out
+    }
+}
+
+/// Object file name for a sealed WAL file: the rendered key template, or the
+/// WAL file stem when no template is set.
+pub(crate) fn render_stem(
+    template: Option<&KeyTemplate>,
+    sink: &str,
+    meta: &S3SinkItem,
+    path: &Path,
+    seq: u64,
+) -> String {
+    let stem = file_stem(path);
+    match template {
+        Some(t) => t.render(
+            sink,
+            meta.module.as_deref(),
+            &stem,
+            seq,
+            meta.batch_id.as_deref(),
+        ),
+        None => stem,
+    }
+}
+
+fn uuid_string(v: u128) -> String {
+    let h = format!("{v:032x}");
+    format!(
+        "{}-{}-{}-{}-{}",
+        &h[0..8],
+        &h[8..12],
+        &h[12..16],
+        &h[16..20],
+        &h[20..32]
+    )
+}
+
+pub(crate) fn file_stem(local_path: &Path) -> String {
+    let base = base_for(local_path);
+    base.file_name().unwrap().to_string_lossy().into_owned()
+}
+
+pub(crate) fn object_key_from(
+    stem: &str,
     prefix: Option<&str>,
     enc: &Encoding,
     comp: &Compression,
 ) -> String {
-    let base = base_for(local_path);
-    let stem = base.file_name().unwrap().to_string_lossy();
-
-    let mut name = String::from(stem.as_ref());
-    name.push_str(enc.extension());
+    let mut name = format!("{stem}.{}", enc.extension());
     name.push_str(comp.extension());
 
     if let Some(p) = prefix {
@@ -240,3 +427,51 @@ fn object_key_from(
         name
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn key_template_renders_batch_fields() {
+        let id = ulid::Ulid::from_parts(1_700_000_000_000, 1).to_string();
+        let t = KeyTemplate::parse("{sink}-{time:%Y%m%dT%H%M%S}-{seq}-{uuid}").unwrap();
+        assert_eq!(
+            t.render("lake", None, &id, 7, None),
+            "lake-20231114T221320-7-018bcfe5-6800-0000-0000-000000000001"
+        );
+
+        let t = KeyTemplate::parse("{module}-{time:%Y%m%d}-{uuid}").unwrap();
+        assert_eq!(
+            t.render("lake", Some("zeek_all"), &id, 0, None),
+            "zeek_all-20231114-018bcfe5-6800-0000-0000-000000000001"
+        );
+        assert_eq!(
+            t.render("lake", None, &id, 0, None),
+            "__unknown__-20231114-018bcfe5-6800-0000-0000-000000000001"
+        );
+    }
+
+    #[test]
+    fn key_template_rejects_unknown_placeholders() {
+        let err = KeyTemplate::parse("{plugin}-{uuid}").unwrap_err();
+        assert!(err.to_string().contains("unknown placeholder {plugin}"));
+        assert!(KeyTemplate::parse("{uuid").is_err());
+
+        let err = KeyTemplate::parse("{time:%Y-%Q}-{uuid}").unwrap_err();
+        assert!(err.to_string().contains(r#"invalid time format "%Y-%Q""#));
+    }
+
+    #[test]
+    fn key_template_needs_a_unique_part() {
+        for t in ["{sink}", "{module}-{seq}", "{sink}-{time:%Y%m%dT%H%M%S}"] {
+            let err = KeyTemplate::parse(t).unwrap_err();
+            assert!(
+                err.to_string().contains("needs {uuid} or {batch_id}"),
+                "{t}: {err}"
+            );
+        }
+        assert!(KeyTemplate::parse("{module}-{seq}-{uuid}").is_ok());
+        assert!(KeyTemplate::parse("{sink}/{batch_id}").is_ok());
+    }
+}
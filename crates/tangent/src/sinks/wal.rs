@@ -18,6 +18,7 @@ use tokio::sync::{Mutex, Semaphore};
 use tokio::task::{spawn_blocking, JoinHandle, JoinSet};
 use tokio::time::{sleep, Duration, Instant};
 
+use crate::sinks::encoding;
 use crate::sinks::manager::{Sink, SinkWrite};
 use crate::sinks::s3;
 use crate::SINK_BYTES_UNCOMPRESSED_TOTAL;
@@ -36,6 +37,9 @@ pub struct DurableFileSink {
     max_file_age: Duration,
     compression: Compression,
     encoding: Encoding,
+    /// Next `{seq}` for key templates, taken once per WAL file and persisted
+    /// in the WAL dir so it keeps counting across restarts.
+    seq: Mutex<u64>,
     rotator: Mutex<Option<JoinHandle<()>>>,
     uploads: tokio::sync::Mutex<JoinSet<()>>,
 }
@@ -44,6 +48,12 @@ pub struct DurableFileSink {
 struct WalMeta {
     bucket_name: Arc<str>,
     key_prefix: Option<Arc<str>>,
+    #[serde(default)]
+    module: Option<Arc<str>>,
+    #[serde(default)]
+    seq: u64,
+    #[serde(default)]
+    batch_id: Option<Arc<str>>,
 
     encoding: Encoding,
     compression: Compression,
@@ -53,6 +63,7 @@ struct WalMeta {
 pub struct RouteKey {
     pub sink_name: Arc<str>,
     pub prefix: Option<Arc<str>>,
+    pub module: Option<Arc<str>>,
 }
 
 struct RouteState {
@@ -76,7 +87,14 @@ pub trait WALSink: Send + Sync {
         encoding: &Encoding,
         compression: &Compression,
         meta: &s3::S3SinkItem,
+        seq: u64,
     ) -> Result<()>;
+
+    /// Whether object keys name the batch they hold (`{batch_id}`), so each
+    /// plugin batch needs a file of its own.
+    fn uses_batch_id(&self) -> bool {
+        false
+    }
 }
 
 impl DurableFileSink {
@@ -91,6 +109,7 @@ impl DurableFileSink {
     ) -> Result<Arc<Self>> {
         let dir = dir.as_ref().to_path_buf();
         tokio::fs::create_dir_all(&dir).await?;
+        let seq = read_seq(&dir).await?;
 
         let s = Arc::new(Self {
             inner,
@@ -102,9 +121,11 @@ impl DurableFileSink {
             max_file_age,
             compression,
             encoding,
+            seq: Mutex::new(seq),
             rotator: Mutex::new(None),
             uploads: Mutex::new(JoinSet::new()),
         });
+        s.finish_sealing().await;
         s.retry_leftovers(false).await;
 
         let s_cloned = s.clone();
@@ -133,7 +154,7 @@ impl DurableFileSink {
     }
 
     async fn rotate_route(&self, rkey: RouteKey) -> anyhow::Result<()> {
-        let (sealed_ready, sealed_bytes, meta) = {
+        let (sealing, sealed_bytes, meta) = {
             let mut routes = self.routes.lock().await;
             let rs = routes
                 .get_mut(&rkey)
@@ -146,23 +167,39 @@ impl DurableFileSink {
                 f.sync_data().await?;
             }
 
-            let mut sealed = rs.cur.path.clone();
-            sealed.set_extension("bin.sealed");
-            fs::rename(&rs.cur.path, &sealed).await?;
+            let sealing = rs.cur.path.with_extension("bin.sealing");
+            fs::rename(&rs.cur.path, &sealing).await?;
             let sealed_bytes = rs.cur.bytes as u64;
 
-            rs.cur = open_route_current(
-                &self.dir,
-                &WalMeta {
-                    bucket_name: rs.meta.bucket_name.clone(),
-                    key_prefix: rs.meta.key_prefix.clone(),
-                    encoding: self.encoding.clone(),
-                    compression: self.compression.clone(),
-                },
-            )
-            .await?;
-
-            (sealed, sealed_bytes, rs.meta.clone())
+            rs.cur = open_route_current(&self.dir, &self.wal_meta(&rs.meta).await?).await?;
+
+            (sealing, sealed_bytes, rs.meta.clone())
+        };
+
+        self.seal_and_upload(&sealing, sealed_bytes, meta).await;
+        Ok(())
+    }
+
+    /// Writes one plugin batch to a WAL file of its own and seals it right
+    /// away, so its object holds exactly that batch and a replay of the same
+    /// input lands on the same `{batch_id}` key.
+    async fn write_batch(&self, meta: s3::S3SinkItem, payload: &[u8]) -> Result<()> {
+        let mut cur = open_route_current(&self.dir, &self.wal_meta(&meta).await?).await?;
+        let mut f = cur.file.take().expect("current file missing");
+        f.write_all(payload).await?;
+        f.sync_data().await?;
+        drop(f);
+
+        let sealing = cur.path.with_extension("bin.sealing");
+        fs::rename(&cur.path, &sealing).await?;
+        self.seal_and_upload(&sealing, payload.len() as u64, meta)
+            .await;
+        Ok(())
+    }
+
+    async fn seal_and_upload(&self, sealing: &Path, sealed_bytes: u64, meta: s3::S3SinkItem) {
+        let Some(sealed_ready) = seal(sealing, &self.encoding, &self.compression).await else {
+            return;
         };
 
         WAL_SEALED_FILES_TOTAL.inc();
@@ -172,7 +209,53 @@ impl DurableFileSink {
 
         self.spawn_upload_with_meta(sealed_ready, sealed_bytes, meta, true)
             .await;
-        Ok(())
+    }
+
+    /// Meta for a new WAL file on a route. The file's `{seq}` is fixed here so
+    /// every upload attempt names the object the same way, and the next one
+    /// is written out before this one is handed out.
+    async fn wal_meta(&self, route: &s3::S3SinkItem) -> Result<WalMeta> {
+        let mut next = self.seq.lock().await;
+        let seq = *next;
+        write_seq(&self.dir, seq + 1).await?;
+        *next = seq + 1;
+        Ok(WalMeta {
+            bucket_name: route.bucket_name.clone(),
+            key_prefix: route.key_prefix.clone(),
+            module: route.module.clone(),
+            seq,
+            batch_id: route.batch_id.clone(),
+            encoding: self.encoding.clone(),
+            compression: self.compression.clone(),
+        })
+    }
+
+    /// Seals files a crash left between rotation and encoding. Runs once at
+    /// startup, before anything can be rotating.
+    async fn finish_sealing(&self) {
+        let Ok(mut rd) = fs::read_dir(&self.dir).await else {
+            return;
+        };
+        while let Ok(Some(ent)) = rd.next_entry().await {
+            let p = ent.path();
+            if !p.to_string_lossy().ends_with(".bin.sealing") {
+                continue;
+            }
+            // The crash came after the encoded file was renamed into place.
+            if fs::try_exists(p.with_extension("sealed"))
+                .await
+                .unwrap_or(false)
+            {
+                let _ = fs::remove_file(&p).await;
+                continue;
+            }
+            match read_meta(&meta_path_for(&p)).await {
+                Ok(meta) => {
+                    let _ = seal(&p, &meta.encoding, &meta.compression).await;
+                }
+                Err(e) => tracing::warn!("missing/corrupt meta for {:?}: {e}", p),
+            }
+        }
     }
 
     async fn retry_leftovers(&self, incr_counters: bool) {
@@ -206,6 +289,8 @@ impl DurableFileSink {
                     s3::S3SinkItem {
                         bucket_name: meta.bucket_name,
                         key_prefix: meta.key_prefix,
+                        module: meta.module,
+                        batch_id: meta.batch_id,
                     },
                     incr_counters,
                 )
@@ -237,37 +322,44 @@ impl DurableFileSink {
             let wal_meta = read_meta(&meta_path).await.unwrap_or_else(|_| WalMeta {
                 bucket_name: route_meta.bucket_name.clone(),
                 key_prefix: route_meta.key_prefix.clone(),
+                module: route_meta.module.clone(),
+                seq: 0,
+                batch_id: route_meta.batch_id.clone(),
                 encoding: encoding.clone(),
                 compression: compression.clone(),
             });
 
-            let (upload_path, upload_size) = match compression {
-                Compression::None => (sealed_path_clone.clone(), orig_size),
-                Compression::Gzip { level } => match encoding {
-                    Encoding::NDJSON | Encoding::JSON => {
-                        compress_gzip_to_file(&sealed_path_clone, level).await?
-                    }
-                    _ => (sealed_path_clone.clone(), orig_size),
-                },
-                Compression::Zstd { level } => match encoding {
-                    Encoding::NDJSON | Encoding::JSON => {
-                        compress_zstd_to_file(&sealed_path_clone, level).await?
-                    }
-                    _ => (sealed_path_clone.clone(), orig_size),
-                },
-                Compression::Snappy { .. } => (sealed_path_clone.clone(), orig_size),
-                Compression::Deflate { .. } => (sealed_path_clone.clone(), orig_size),
+            // Avro and Parquet carry their compression inside the file, so
+            // the object goes up as is and is named without a suffix.
+            let outer = if wal_meta.encoding.compresses_itself() {
+                Compression::None
+            } else {
+                wal_meta.compression.clone()
+            };
+            let (upload_path, upload_size) = match outer {
+                Compression::Gzip { level } => {
+                    compress_gzip_to_file(&sealed_path_clone, level).await?
+                }
+                Compression::Zstd { level } => {
+                    compress_zstd_to_file(&sealed_path_clone, level).await?
+                }
+                Compression::None | Compression::Snappy { .. } | Compression::Deflate { .. } => {
+                    (sealed_path_clone.clone(), orig_size)
+                }
             };
 
             inner
                 .write_path_with(
                     &upload_path,
                     &wal_meta.encoding,
-                    &wal_meta.compression,
+                    &outer,
                     &s3::S3SinkItem {
                         bucket_name: wal_meta.bucket_name,
                         key_prefix: wal_meta.key_prefix,
+                        module: wal_meta.module,
+                        batch_id: wal_meta.batch_id,
                     },
+                    wal_meta.seq,
                 )
                 .await?;
 
@@ -305,12 +397,20 @@ impl DurableFileSink {
 #[async_trait::async_trait]
 impl Sink for DurableFileSink {
     async fn write(&self, req: SinkWrite) -> Result<()> {
-        let Some(meta) = req.s3 else {
+        let Some(mut meta) = req.s3 else {
             anyhow::bail!("DurableFileSink requires s3 meta (bucket/prefix)")
         };
+        if meta.batch_id.is_some() {
+            if self.inner.uses_batch_id() {
+                return self.write_batch(meta, &req.payload).await;
+            }
+            // Shared route files hold many batches; don't name them by one.
+            meta.batch_id = None;
+        }
         let rkey = RouteKey {
             sink_name: req.sink_name,
             prefix: meta.key_prefix.clone(),
+            module: meta.module.clone(),
         };
 
         let mut need_create = false;
@@ -322,16 +422,7 @@ impl Sink for DurableFileSink {
         }
 
         if need_create {
-            let cur = open_route_current(
-                &self.dir,
-                &WalMeta {
-                    bucket_name: meta.bucket_name.clone(),
-                    key_prefix: meta.key_prefix.clone(),
-                    encoding: self.encoding.clone(),
-                    compression: self.compression.clone(),
-                },
-            )
-            .await?;
+            let cur = open_route_current(&self.dir, &self.wal_meta(&meta).await?).await?;
             {
                 let mut routes = self.routes.lock().await;
                 if !routes.contains_key(&rkey) {
@@ -365,6 +456,10 @@ impl Sink for DurableFileSink {
         Ok(())
     }
 
+    fn uses_batch_id(&self) -> bool {
+        self.inner.uses_batch_id()
+    }
+
     async fn flush(&self) -> Result<()> {
         let value = self.rotator.lock().await.take();
         if let Some(h) = value {
@@ -405,6 +500,53 @@ impl Sink for DurableFileSink {
     }
 }
 
+/// Encodes a rotated NDJSON file (`.bin.sealing`) in the sink's encoding and
+/// renames the result to `.bin.sealed`, so every sealed file is ready to
+/// upload as is. A file that fails to encode is set aside as `.bin.rejected`,
+/// with its meta, rather than blocking the route or going up under the wrong
+/// format.
+async fn seal(sealing: &Path, enc: &Encoding, comp: &Compression) -> Option<PathBuf> {
+    let sealed = sealing.with_extension("sealed");
+    match encode_to(sealing, &sealed, enc, comp).await {
+        Ok(()) => Some(sealed),
+        Err(e) => {
+            let rejected = sealing.with_extension("rejected");
+            tracing::warn!(
+                "encoding {:?} failed, keeping it as {:?}: {e}",
+                sealing,
+                rejected
+            );
+            let _ = fs::rename(sealing, &rejected).await;
+            None
+        }
+    }
+}
+
+async fn encode_to(src: &Path, dst: &Path, enc: &Encoding, comp: &Compression) -> Result<()> {
+    if matches!(enc, Encoding::NDJSON) {
+        fs::rename(src, dst).await?;
+        return Ok(());
+    }
+
+    let src = src.to_path_buf();
+    let dst = dst.to_path_buf();
+    let enc = enc.clone();
+    let comp = comp.clone();
+    spawn_blocking(move || -> Result<()> {
+        let raw = std::fs::read(&src)?;
+        let encoded = encoding::normalize_from_ndjson(&enc, &comp, raw.as_slice().into())?;
+
+        let tmp = dst.with_extension("sealed.tmp");
+        let mut f = stdFile::create(&tmp)?;
+        std::io::Write::write_all(&mut f, &encoded)?;
+        f.sync_data()?;
+        std::fs::rename(&tmp, &dst)?;
+        std::fs::remove_file(&src)?;
+        Ok(())
+    })
+    .await?
+}
+
 async fn compress_zstd_to_file(src: &Path, level: i32) -> Result<(PathBuf, u64)> {
     let dst = src.with_extension("sealed.zst");
     let dst_tmp = dst.with_extension("sealed.zst.tmp");
@@ -456,9 +598,12 @@ pub fn base_for(path: &Path) -> PathBuf {
         }
     }
 
-    if out.ends_with(".sealed") {
-        let new_len = out.len() - ".sealed".len();
-        out.truncate(new_len);
+    for stage in [".sealed", ".sealing", ".rejected"] {
+        if out.ends_with(stage) {
+            let new_len = out.len() - stage.len();
+            out.truncate(new_len);
+            break;
+        }
     }
 
     if out.ends_with(".bin") {
@@ -490,6 +635,28 @@ async fn write_meta_atomic(meta_path: &Path, meta: &WalMeta) -> anyhow::Result<(
     Ok(())
 }
 
+/// File in the WAL dir holding the next `{seq}`.
+const SEQ_FILE: &str = "seq";
+
+async fn read_seq(dir: &Path) -> anyhow::Result<u64> {
+    match fs::read_to_string(dir.join(SEQ_FILE)).await {
+        Ok(s) => Ok(s.trim().parse()?),
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(0),
+        Err(e) => Err(e.into()),
+    }
+}
+
+async fn write_seq(dir: &Path, next: u64) -> anyhow::Result<()> {
+    let path = dir.join(SEQ_FILE);
+    let tmp = path.with_extension("tmp");
+    let mut f = File::create(&tmp).await?;
+    f.write_all(next.to_string().as_bytes()).await?;
+    f.sync_data().await?;
+    drop(f);
+    fs::rename(&tmp, &path).await?;
+    Ok(())
+}
+
 async fn read_meta(meta_path: &Path) -> anyhow::Result<WalMeta> {
     let bytes = fs::read(meta_path).await?;
     Ok(serde_json::from_slice(&bytes)?)
@@ -535,3 +702,257 @@ async fn open_route_current(dir: &Path, meta: &WalMeta) -> anyhow::Result<Curren
         created_at: Instant::now(),
     })
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use bytes::BytesMut;
+
+    /// Records what each upload would send: the file bytes, the compression
+    /// the object is labelled with, its `{seq}` and the WAL file it came
+    /// from with its rendered name.
+    #[derive(Default)]
+    struct RecordingSink {
+        key_template: Option<s3::KeyTemplate>,
+        uploads: std::sync::Mutex<Vec<(Vec<u8>, Compression, u64, String, String)>>,
+    }
+
+    #[async_trait]
+    impl WALSink for RecordingSink {
+        async fn write_path_with(
+            &self,
+            path: &Path,
+            _encoding: &Encoding,
+            compression: &Compression,
+            meta: &s3::S3SinkItem,
+            seq: u64,
+        ) -> Result<()> {
+            let body = fs::read(path).await?;
+            let stem = s3::render_stem(self.key_template.as_ref(), "lake", meta, path, seq);
+            self.uploads.lock().unwrap().push((
+                body,
+                compression.clone(),
+                seq,
+                s3::file_stem(path),
+                stem,
+            ));
+            Ok(())
+        }
+
+        fn uses_batch_id(&self) -> bool {
+            self.key_template
+                .as_ref()
+                .is_some_and(s3::KeyTemplate::uses_batch_id)
+        }
+    }
+
+    async fn write(sink: &DurableFileSink, payload: &[u8], batch_id: Option<Arc<str>>) {
+        let meta = s3::S3SinkItem {
+            bucket_name: Arc::from("bucket"),
+            key_prefix: None,
+            module: Some(Arc::from("zeek_all")),
+            batch_id,
+        };
+        sink.write(SinkWrite {
+            sink_name: Arc::from("lake"),
+            payload: BytesMut::from(payload),
+            s3: Some(meta),
+        })
+        .await
+        .unwrap();
+    }
+
+    async fn write_and_rotate(sink: &DurableFileSink, payload: &[u8]) {
+        write(sink, payload, None).await;
+        sink.rotate_route(RouteKey {
+            sink_name: Arc::from("lake"),
+            prefix: None,
+            module: Some(Arc::from("zeek_all")),
+        })
+        .await
+        .unwrap();
+        wait_for_uploads(sink).await;
+    }
+
+    async fn wait_for_uploads(sink: &DurableFileSink) {
+        let mut js = std::mem::take(&mut *sink.uploads.lock().await);
+        while js.join_next().await.is_some() {}
+    }
+
+    async fn count_suffix(dir: &Path, suffix: &str) -> usize {
+        let mut rd = fs::read_dir(dir).await.unwrap();
+        let mut n = 0;
+        while let Some(ent) = rd.next_entry().await.unwrap() {
+            if ent.file_name().to_string_lossy().ends_with(suffix) {
+                n += 1;
+            }
+        }
+        n
+    }
+
+    async fn open(
+        dir: &Path,
+        inner: Arc<RecordingSink>,
+        compression: Compression,
+        encoding: Encoding,
+    ) -> Arc<DurableFileSink> {
+        DurableFileSink::new(
+            inner,
+            dir,
+            4,
+            1 << 20,
+            Duration::from_secs(3600),
+            compression,
+            encoding,
+        )
+        .await
+        .unwrap()
+    }
+
+    #[tokio::test]
+    async fn self_compressed_encodings_skip_outer_compression() {
+        let dir = tempfile::tempdir().unwrap();
+        let inner = Arc::new(RecordingSink::default());
+        let schema = r#"{"type":"record","name":"r","fields":[{"name":"x","type":"long"}]}"#;
+        let sink = open(
+            dir.path(),
+            inner.clone(),
+            Compression::Zstd { level: 3 },
+            Encoding::Avro {
+                schema: schema.into(),
+            },
+        )
+        .await;
+
+        write_and_rotate(&sink, b"{\"x\":1}\n{\"x\":2}\n").await;
+
+        let uploads = inner.uploads.lock().unwrap();
+        assert_eq!(uploads.len(), 1);
+        assert!(uploads[0].0.starts_with(b"Obj\x01"));
+        assert!(matches!(uploads[0].1, Compression::None));
+    }
+
+    #[tokio::test]
+    async fn encode_errors_set_the_file_aside_and_keep_rotating() {
+        let dir = tempfile::tempdir().unwrap();
+        let inner = Arc::new(RecordingSink::default());
+        let sink = open(
+            dir.path(),
+            inner.clone(),
+            Compression::None,
+            Encoding::Avro {
+                schema: "not a schema".into(),
+            },
+        )
+        .await;
+
+        write_and_rotate(&sink, b"{\"x\":1}\n").await;
+        write_and_rotate(&sink, b"{\"x\":2}\n").await;
+
+        assert!(inner.uploads.lock().unwrap().is_empty());
+        assert_eq!(count_suffix(dir.path(), ".bin.rejected").await, 2);
+        assert_eq!(count_suffix(dir.path(), ".bin.sealed").await, 0);
+    }
+
+    #[tokio::test]
+    async fn leftovers_are_encoded_before_upload() {
+        let dir = tempfile::tempdir().unwrap();
+        let meta = WalMeta {
+            bucket_name: Arc::from("bucket"),
+            key_prefix: None,
+            module: None,
+            seq: 0,
+            batch_id: None,
+            encoding: Encoding::JSON,
+            compression: Compression::None,
+        };
+        let base = dir.path().join(ulid::Ulid::new().to_string());
+        write_meta_atomic(&base.with_extension("meta"), &meta)
+            .await
+            .unwrap();
+        fs::write(
+            base.with_extension("bin.sealing"),
+            b"{\"x\":1}\n{\"x\":2}\n",
+        )
+        .await
+        .unwrap();
+
+        let inner = Arc::new(RecordingSink::default());
+        let sink = open(dir.path(), inner.clone(), Compression::None, Encoding::JSON).await;
+        wait_for_uploads(&sink).await;
+
+        let uploads = inner.uploads.lock().unwrap();
+        assert_eq!(uploads.len(), 1);
+        let body: serde_json::Value = serde_json::from_slice(&uploads[0].0).unwrap();
+        assert_eq!(body, serde_json::json!([{"x": 1}, {"x": 2}]));
+    }
+
+    #[tokio::test]
+    async fn seq_keeps_counting_across_restarts() {
+        let dir = tempfile::tempdir().unwrap();
+        let inner = Arc::new(RecordingSink::default());
+
+        let sink = open(
+            dir.path(),
+            inner.clone(),
+            Compression::None,
+            Encoding::NDJSON,
+        )
+        .await;
+        write_and_rotate(&sink, b"{\"x\":1}\n").await;
+        write_and_rotate(&sink, b"{\"x\":2}\n").await;
+        drop(sink);
+
+        let sink = open(
+            dir.path(),
+            inner.clone(),
+            Compression::None,
+            Encoding::NDJSON,
+        )
+        .await;
+        write_and_rotate(&sink, b"{\"x\":3}\n").await;
+
+        let seqs: Vec<u64> = inner.uploads.lock().unwrap().iter().map(|u| u.2).collect();
+        assert_eq!(seqs, vec![0, 1, 3]);
+    }
+
+    #[tokio::test]
+    async fn batch_id_is_stable_for_identical_input_in_different_files() {
+        let dir = tempfile::tempdir().unwrap();
+        let inner = Arc::new(RecordingSink {
+            key_template: Some(s3::KeyTemplate::parse("{module}/{batch_id}").unwrap()),
+            ..Default::default()
+        });
+        let sink = open(
+            dir.path(),
+            inner.clone(),
+            Compression::None,
+            Encoding::NDJSON,
+        )
+        .await;
+
+        let input: [&[u8]; 2] = [br#"{"x":1}"#, br#"{"x":2}"#];
+        let id = crate::worker::batch_id("zeek", "0.1.0", input);
+        assert_eq!(id.len(), 32);
+        assert_eq!(id, crate::worker::batch_id("zeek", "0.1.0", input));
+        assert_ne!(id, crate::worker::batch_id("zeek", "0.2.0", input));
+        assert_ne!(id, crate::worker::batch_id("zeek", "0.1.0", &input[..1]));
+
+        // A retry of the same input comes back after other output has been
+        // written, and still names its object the same.
+        write(&sink, b"{\"y\":1}\n", Some(id.clone())).await;
+        write_and_rotate(&sink, b"{\"z\":1}\n").await;
+        write(&sink, b"{\"y\":1}\n", Some(id.clone())).await;
+        wait_for_uploads(&sink).await;
+
+        let uploads = inner.uploads.lock().unwrap();
+        let batched: Vec<_> = uploads.iter().filter(|u| u.0 == b"{\"y\":1}\n").collect();
+        assert_eq!(batched.len(), 2);
+        assert_ne!(batched[0].3, batched[1].3);
+        for u in &batched {
+            assert_eq!(u.4, format!("zeek_all/{id}"));
+        }
+        let shared = uploads.iter().find(|u| u.0 == b"{\"z\":1}\n").unwrap();
+        assert_eq!(shared.4, format!("zeek_all/{}", shared.3));
+    }
+}
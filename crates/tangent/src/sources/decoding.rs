@@ -1,62 +1,196 @@
-use std::io::{self, Write};
+use std::io::{self, Read};
 
 use anyhow::Result;
 use bytes::{BufMut, Bytes, BytesMut};
-use memchr::{memchr, memchr_iter};
+use memchr::{memchr, memchr_iter, memrchr};
 use serde::Deserialize;
-use tangent_shared::sources::common::{DecodeCompression, DecodeFormat};
+use tangent_shared::sources::common::{
+    is_gzip, is_zstd, DecodeCompression, DecodeFormat, Decoding, InvalidUtf8,
+};
+
+use crate::sources::zeek_tsv::zeek_tsv_to_ndjson;
+
+/// Bytes of decompressed input handed on at a time by [`BlockDecoder`].
+pub const DECODE_BLOCK_BYTES: usize = 1 << 20;
 
 pub fn decompress_bytes(comp: &DecodeCompression, data: BytesMut) -> Result<BytesMut> {
-    Ok(match comp {
-        DecodeCompression::None | DecodeCompression::Auto => data,
-        DecodeCompression::Gzip => {
-            use flate2::read::GzDecoder;
-            let mut dec = GzDecoder::new(&data[..]);
-            let mut out = BytesMut::new();
-            let mut w = BytesMutWriter(&mut out);
-            std::io::copy(&mut dec, &mut w)?;
-            out
-        }
-        DecodeCompression::Zstd => {
-            let mut dec = zstd::stream::read::Decoder::new(&data[..])?;
-            let mut out = BytesMut::new();
-            let mut w = BytesMutWriter(&mut out);
-            std::io::copy(&mut dec, &mut w)?;
-            out
-        }
-    })
+    let plain = match comp {
+        DecodeCompression::None => true,
+        DecodeCompression::Auto => !is_gzip(&data) && !is_zstd(&data),
+        _ => false,
+    };
+    if plain {
+        return Ok(data);
+    }
+    decompress_vec(comp, &data)
 }
 
 pub fn decompress_vec(comp: &DecodeCompression, data: &[u8]) -> Result<BytesMut> {
-    Ok(match comp {
-        DecodeCompression::None | DecodeCompression::Auto => BytesMut::from(data),
-        DecodeCompression::Gzip => {
-            use flate2::read::GzDecoder;
-            let mut dec = GzDecoder::new(&data[..]);
-            let mut out = BytesMut::new();
-            let mut w = BytesMutWriter(&mut out);
-            std::io::copy(&mut dec, &mut w)?;
-            out
+    let mut dec = Decompressor::new(comp, data)?;
+    let mut out = BytesMut::new();
+    let mut block = vec![0u8; 64 * 1024];
+    loop {
+        let n = dec.read(&mut block)?;
+        if n == 0 {
+            return Ok(out);
         }
-        DecodeCompression::Zstd => {
-            let mut dec = zstd::stream::read::Decoder::new(&data[..])?;
-            let mut out = BytesMut::new();
-            let mut w = BytesMutWriter(&mut out);
-            std::io::copy(&mut dec, &mut w)?;
-            out
+        out.extend_from_slice(&block[..n]);
+    }
+}
+
+/// Streams decompressed input. `Auto` sniffs the gzip and zstd magic bytes
+/// so payloads without a content encoding or file name still decode.
+enum Decompressor<'a> {
+    Plain(&'a [u8]),
+    /// Reads every gzip member; shippers often concatenate gzip files.
+    Gzip(flate2::read::MultiGzDecoder<CountingReader<'a>>),
+    Zstd(zstd::stream::read::Decoder<'static, io::BufReader<&'a [u8]>>),
+}
+
+impl<'a> Decompressor<'a> {
+    fn new(comp: &DecodeCompression, data: &'a [u8]) -> Result<Self> {
+        let gzip = || {
+            Self::Gzip(flate2::read::MultiGzDecoder::new(CountingReader {
+                inner: data,
+                read: 0,
+            }))
+        };
+        Ok(match comp {
+            DecodeCompression::None => Self::Plain(data),
+            DecodeCompression::Gzip => gzip(),
+            DecodeCompression::Zstd => Self::Zstd(zstd::stream::read::Decoder::new(data)?),
+            DecodeCompression::Auto if is_gzip(data) => gzip(),
+            DecodeCompression::Auto if is_zstd(data) => {
+                Self::Zstd(zstd::stream::read::Decoder::new(data)?)
+            }
+            DecodeCompression::Auto => Self::Plain(data),
+        })
+    }
+
+    /// Gzip errors report how far into the compressed input they occurred.
+    fn read(&mut self, buf: &mut [u8]) -> Result<usize> {
+        match self {
+            Self::Plain(data) => Ok(data.read(buf)?),
+            Self::Gzip(dec) => dec.read(buf).map_err(|e| {
+                let counted = dec.get_ref();
+                anyhow::anyhow!(
+                    "corrupt gzip input at byte {} of {}: {e}",
+                    counted.read,
+                    counted.read + counted.inner.len()
+                )
+            }),
+            Self::Zstd(dec) => Ok(dec.read(buf)?),
         }
-    })
+    }
 }
 
-struct BytesMutWriter<'a>(&'a mut BytesMut);
+struct CountingReader<'a> {
+    inner: &'a [u8],
+    read: usize,
+}
 
-impl<'a> Write for BytesMutWriter<'a> {
-    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
-        self.0.extend_from_slice(buf);
-        Ok(buf.len())
+impl io::Read for CountingReader<'_> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        let n = self.inner.read(buf)?;
+        self.read += n;
+        Ok(n)
     }
-    fn flush(&mut self) -> io::Result<()> {
-        Ok(())
+}
+
+/// Decompresses and normalizes one payload into NDJSON blocks. NDJSON and
+/// text input is handed on in line-aligned blocks of about `block` bytes, so
+/// memory follows the block rather than the decompressed payload. Formats
+/// that need the whole document (JSON, MessagePack, Zeek TSV, or NDJSON
+/// holding a top-level array) come back as one block.
+pub struct BlockDecoder<'a> {
+    dec: Decompressor<'a>,
+    format: DecodeFormat,
+    policy: InvalidUtf8,
+    block: usize,
+    buf: BytesMut,
+    scratch: Vec<u8>,
+    streaming: Option<bool>,
+    done: bool,
+}
+
+impl<'a> BlockDecoder<'a> {
+    pub fn new(
+        decoding: &Decoding,
+        comp: &DecodeCompression,
+        data: &'a [u8],
+        block: usize,
+    ) -> Result<Self> {
+        Ok(Self {
+            dec: Decompressor::new(comp, data)?,
+            format: decoding.format.clone(),
+            policy: decoding.invalid_utf8.clone(),
+            block: block.max(1),
+            buf: BytesMut::new(),
+            scratch: vec![0u8; block.clamp(1, 64 * 1024)],
+            streaming: None,
+            done: false,
+        })
+    }
+
+    /// Decided by the first non-blank byte: a top-level array must be read
+    /// whole.
+    fn streams(&mut self) -> bool {
+        if self.streaming.is_none() {
+            if !matches!(self.format, DecodeFormat::Ndjson | DecodeFormat::Text) {
+                self.streaming = Some(false);
+            } else {
+                let body = self.buf.strip_prefix(UTF8_BOM).unwrap_or(&self.buf[..]);
+                match body.iter().find(|b| !b.is_ascii_whitespace()) {
+                    Some(b) => self.streaming = Some(*b != b'['),
+                    None => return true,
+                }
+            }
+        }
+        self.streaming == Some(true)
+    }
+
+    fn finish(&self, raw: BytesMut) -> Option<Result<BytesMut>> {
+        let body = raw.strip_prefix(UTF8_BOM).unwrap_or(&raw[..]);
+        if body.iter().all(u8::is_ascii_whitespace) {
+            return None;
+        }
+        Some(
+            normalize_to_ndjson(&self.format, raw)
+                .map(|ndjson| apply_utf8_policy(&self.policy, ndjson)),
+        )
+    }
+}
+
+impl Iterator for BlockDecoder<'_> {
+    type Item = Result<BytesMut>;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        while !self.done {
+            let n = match self.dec.read(&mut self.scratch) {
+                Ok(n) => n,
+                Err(e) => {
+                    self.done = true;
+                    return Some(Err(e));
+                }
+            };
+            if n == 0 {
+                self.done = true;
+                let rest = self.buf.split();
+                return self.finish(rest);
+            }
+            self.buf.extend_from_slice(&self.scratch[..n]);
+
+            if self.buf.len() < self.block || !self.streams() {
+                continue;
+            }
+            if let Some(nl) = memrchr(b'\n', &self.buf) {
+                let piece = self.buf.split_to(nl + 1);
+                if let Some(out) = self.finish(piece) {
+                    return Some(out);
+                }
+            }
+        }
+        None
     }
 }
 
@@ -80,6 +214,18 @@ pub fn json_to_ndjson(v: &serde_json::Value) -> BytesMut {
     }
 }
 
+/// Reads any sequence of whitespace-separated JSON values, one-line or
+/// pretty-printed, into one log per value. Top-level arrays (as sent by
+/// CloudWatch subscriptions and some webhook relays) contribute one log per
+/// element; arrays nested inside elements are left alone.
+fn json_values_to_ndjson(data: &[u8]) -> Result<BytesMut> {
+    let mut buf = BytesMut::new();
+    for v in serde_json::Deserializer::from_slice(data).into_iter::<serde_json::Value>() {
+        buf.extend_from_slice(&json_to_ndjson(&v?));
+    }
+    Ok(buf)
+}
+
 pub fn msgpack_to_ndjson(data: &[u8]) -> Result<BytesMut> {
     use rmp_serde::Deserializer;
     let mut de = Deserializer::from_read_ref(data);
@@ -87,9 +233,45 @@ pub fn msgpack_to_ndjson(data: &[u8]) -> Result<BytesMut> {
     Ok(json_to_ndjson(&val))
 }
 
+const UTF8_BOM: &[u8] = b"\xEF\xBB\xBF";
+
+/// Tidies one newline-terminated line from Windows-style exports: drops a
+/// leading UTF-8 BOM and a CR before the newline. Blank lines yield `None`.
+pub fn clean_line(mut line: BytesMut) -> Option<BytesMut> {
+    if line.starts_with(UTF8_BOM) {
+        let _ = line.split_to(UTF8_BOM.len());
+    }
+    if line.iter().all(u8::is_ascii_whitespace) {
+        return None;
+    }
+    if line.ends_with(b"\r\n") {
+        line.truncate(line.len() - 2);
+        line.put_u8(b'\n');
+    }
+    Some(line)
+}
+
+/// [`clean_line`] followed by the invalid UTF-8 policy, for sources that
+/// read one line at a time.
+pub fn clean_line_with(policy: &InvalidUtf8, line: BytesMut) -> Option<BytesMut> {
+    let line = apply_utf8_policy(policy, clean_line(line)?);
+    (!line.is_empty()).then_some(line)
+}
+
 pub fn normalize_to_ndjson(fmt: &DecodeFormat, mut raw: BytesMut) -> Result<BytesMut> {
+    if raw.starts_with(UTF8_BOM) {
+        let _ = raw.split_to(UTF8_BOM.len());
+    }
     match fmt {
         DecodeFormat::Ndjson | DecodeFormat::Text => {
+            let start = raw
+                .iter()
+                .position(|b| !b.is_ascii_whitespace())
+                .unwrap_or(raw.len());
+            if raw[start..].starts_with(b"[") {
+                return json_values_to_ndjson(&raw[start..]);
+            }
+            let _ = raw.split_to(start);
             if !raw.starts_with(b"{") {
                 anyhow::bail!("input is not valid ndjson")
             }
@@ -98,18 +280,16 @@ pub fn normalize_to_ndjson(fmt: &DecodeFormat, mut raw: BytesMut) -> Result<Byte
             }
             Ok(raw)
         }
-        DecodeFormat::Json | DecodeFormat::JsonArray => {
-            match serde_json::from_slice::<serde_json::Value>(&raw) {
-                Ok(v) => Ok(json_to_ndjson(&v)),
-                Err(e) => {
-                    tracing::warn!(error=?e, "failed JSON parse; fallback to text");
-                    if !raw.ends_with(b"\n") {
-                        raw.put_u8(b'\n');
-                    }
-                    Ok(raw)
+        DecodeFormat::Json | DecodeFormat::JsonArray => match json_values_to_ndjson(&raw) {
+            Ok(v) => Ok(v),
+            Err(e) => {
+                tracing::warn!(error=?e, "failed JSON parse; fallback to text");
+                if !raw.ends_with(b"\n") {
+                    raw.put_u8(b'\n');
                 }
+                Ok(raw)
             }
-        }
+        },
         DecodeFormat::Msgpack => match msgpack_to_ndjson(&raw) {
             Ok(v) => Ok(v),
             Err(e) => {
@@ -120,16 +300,55 @@ pub fn normalize_to_ndjson(fmt: &DecodeFormat, mut raw: BytesMut) -> Result<Byte
                 Ok(raw)
             }
         },
+        DecodeFormat::ZeekTsv => zeek_tsv_to_ndjson(&raw),
     }
 }
 
+fn is_control(b: u8) -> bool {
+    b < 0x20 && !matches!(b, b'\t' | b'\r' | b'\n')
+}
+
+/// Applies the source's invalid UTF-8 policy to each NDJSON line.
+pub fn apply_utf8_policy(policy: &InvalidUtf8, ndjson: BytesMut) -> BytesMut {
+    if matches!(policy, InvalidUtf8::Passthrough)
+        || (std::str::from_utf8(&ndjson).is_ok() && !ndjson.iter().copied().any(is_control))
+    {
+        return ndjson;
+    }
+
+    let mut out = BytesMut::with_capacity(ndjson.len());
+    for (i, line) in ndjson[..].split_inclusive(|b| *b == b'\n').enumerate() {
+        let bad_utf8 = std::str::from_utf8(line).err().map(|e| e.valid_up_to());
+        let bad_ctrl = line.iter().position(|b| is_control(*b));
+        if bad_utf8.is_none() && bad_ctrl.is_none() {
+            out.extend_from_slice(line);
+            continue;
+        }
+        match policy {
+            InvalidUtf8::Reject => {
+                let (what, at) = match (bad_utf8, bad_ctrl) {
+                    (Some(u), Some(c)) if c < u => ("control byte", c),
+                    (Some(u), _) => ("invalid UTF-8", u),
+                    (None, Some(c)) => ("control byte", c),
+                    (None, None) => unreachable!(),
+                };
+                tracing::warn!(line = i + 1, byte = at, "dropping input line: {what}");
+            }
+            InvalidUtf8::Replace => {
+                let s = String::from_utf8_lossy(line);
+                out.extend(s.bytes().filter(|b| !is_control(*b)));
+            }
+            InvalidUtf8::Passthrough => out.extend_from_slice(line),
+        }
+    }
+    out
+}
+
 pub fn chunk_ndjson(buf: &mut BytesMut, chunks: usize) -> Vec<BytesMut> {
     let mut out = Vec::with_capacity(chunks);
     loop {
         match memchr(b'\n', &buf[..]) {
-            Some(nl) => {
-                out.push(buf.split_to(nl + 1));
-            }
+            Some(nl) => out.extend(clean_line(buf.split_to(nl + 1))),
             None => break,
         }
     }
@@ -174,3 +393,184 @@ pub fn ndjson_chunk_slices(buf: Bytes, max_chunk: usize) -> Vec<Bytes> {
     }
     chunks
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io::Write;
+
+    #[test]
+    fn ndjson_input_accepts_top_level_arrays() {
+        let mut raw = String::from(" \n\t [");
+        for i in 0..10_000 {
+            if i > 0 {
+                raw.push(',');
+            }
+            raw.push_str(&format!(r#"{{"i":{i},"tags":[1,2]}}"#));
+        }
+        raw.push_str("]\n");
+
+        let out = normalize_to_ndjson(&DecodeFormat::Ndjson, BytesMut::from(raw.as_str())).unwrap();
+        let lines: Vec<&[u8]> = out[..]
+            .split(|b| *b == b'\n')
+            .filter(|l| !l.is_empty())
+            .collect();
+        assert_eq!(lines.len(), 10_000);
+        assert_eq!(lines[9_999], br#"{"i":9999,"tags":[1,2]}"#);
+    }
+
+    fn gzip(data: &[u8]) -> Vec<u8> {
+        let mut enc = flate2::write::GzEncoder::new(Vec::new(), flate2::Compression::fast());
+        enc.write_all(data).unwrap();
+        enc.finish().unwrap()
+    }
+
+    #[test]
+    fn gzip_reads_every_member() {
+        let mut data = gzip(b"{\"a\":1}\n");
+        data.extend(gzip(b"{\"b\":2}\n"));
+        let out = decompress_vec(&DecodeCompression::Gzip, &data).unwrap();
+        assert_eq!(&out[..], b"{\"a\":1}\n{\"b\":2}\n");
+    }
+
+    #[test]
+    fn corrupt_gzip_names_the_offset() {
+        let mut data = gzip(&b"{\"a\":1}\n".repeat(100));
+        let mid = data.len() / 2;
+        data[mid..].fill(0xff);
+        let err = decompress_vec(&DecodeCompression::Gzip, &data).unwrap_err();
+        assert!(err.to_string().starts_with("corrupt gzip input at byte "));
+    }
+
+    #[test]
+    fn auto_sniffs_compression_without_hints() {
+        let data = gzip(b"{\"a\":1}\n");
+        let out = decompress_vec(&DecodeCompression::Auto, &data).unwrap();
+        assert_eq!(&out[..], b"{\"a\":1}\n");
+
+        let data = zstd::encode_all(&b"{\"b\":2}\n"[..], 0).unwrap();
+        let out = decompress_bytes(&DecodeCompression::Auto, BytesMut::from(&data[..])).unwrap();
+        assert_eq!(&out[..], b"{\"b\":2}\n");
+
+        let out = decompress_bytes(&DecodeCompression::Auto, BytesMut::from("{}\n")).unwrap();
+        assert_eq!(&out[..], b"{}\n");
+    }
+
+    fn decoding(format: DecodeFormat) -> Decoding {
+        Decoding {
+            format,
+            compression: DecodeCompression::Auto,
+            invalid_utf8: InvalidUtf8::Reject,
+        }
+    }
+
+    #[test]
+    fn block_decoder_streams_line_aligned_blocks() {
+        let line = b"{\"msg\":\"0123456789\"}\n";
+        let mut data = gzip(&line.repeat(50));
+        data.extend(gzip(&line.repeat(50)));
+
+        let dc = decoding(DecodeFormat::Ndjson);
+        let blocks: Vec<BytesMut> = BlockDecoder::new(&dc, &dc.compression, &data, 100)
+            .unwrap()
+            .collect::<Result<_>>()
+            .unwrap();
+        assert!(blocks.len() > 10);
+        for b in &blocks {
+            assert!(b.len() < 2 * 100);
+            assert!(b.ends_with(b"\n"));
+        }
+        assert_eq!(blocks.concat(), line.repeat(100));
+    }
+
+    #[test]
+    fn block_decoder_reads_whole_documents_at_once() {
+        let raw = format!("[{}]", vec![r#"{"a":1}"#; 50].join(",\n"));
+        for format in [DecodeFormat::Ndjson, DecodeFormat::Json] {
+            let dc = decoding(format);
+            let blocks: Vec<BytesMut> = BlockDecoder::new(&dc, &dc.compression, raw.as_bytes(), 16)
+                .unwrap()
+                .collect::<Result<_>>()
+                .unwrap();
+            assert_eq!(blocks.len(), 1);
+            assert_eq!(&blocks[0][..], "{\"a\":1}\n".repeat(50).as_bytes());
+        }
+    }
+
+    #[test]
+    fn block_decoder_reports_corrupt_gzip() {
+        let mut data = gzip(&b"{\"a\":1}\n".repeat(100));
+        let mid = data.len() / 2;
+        data[mid..].fill(0xff);
+        let dc = decoding(DecodeFormat::Ndjson);
+        let err = BlockDecoder::new(&dc, &dc.compression, &data, 16)
+            .unwrap()
+            .find_map(Result::err)
+            .unwrap();
+        assert!(err.to_string().starts_with("corrupt gzip input at byte "));
+    }
+
+    #[test]
+    fn clean_line_handles_crlf_bom_and_blanks() {
+        let cases: &[(&[u8], Option<&[u8]>)] = &[
+            (&b"{\"a\":1}\n"[..], Some(&b"{\"a\":1}\n"[..])),
+            (&b"{\"a\":1}\r\n"[..], Some(&b"{\"a\":1}\n"[..])),
+            (&b"\xEF\xBB\xBF{\"a\":1}\r\n"[..], Some(&b"{\"a\":1}\n"[..])),
+            (&b"\xEF\xBB\xBF\r\n"[..], None),
+            (&b"\xEF\xBB\xBF"[..], None),
+            (&b"\r\n"[..], None),
+            (&b"\r"[..], None),
+            (&b"\n"[..], None),
+            (&b"  \t \n"[..], None),
+            (&b"{\"a\":\"x\ry\"}\n"[..], Some(&b"{\"a\":\"x\ry\"}\n"[..])),
+        ];
+        for (input, want) in cases {
+            let got = clean_line(BytesMut::from(*input));
+            assert_eq!(got.as_deref(), *want, "input {input:?}");
+        }
+    }
+
+    #[test]
+    fn chunking_skips_blank_lines() {
+        let mut buf = BytesMut::from(&b"\xEF\xBB\xBF{\"a\":1}\r\n\r\n\n{\"b\":2}\r\n"[..]);
+        let lines = chunk_ndjson(&mut buf, 0);
+        assert_eq!(lines, vec![&b"{\"a\":1}\n"[..], &b"{\"b\":2}\n"[..]]);
+    }
+
+    #[test]
+    fn json_input_accepts_pretty_printed_and_single_line_objects() {
+        let raw = "{\"a\":1}\n{\n  \"b\": {\n    \"c\": [1, 2]\n  }\n}\n{\"d\":\"x\\ny\"}\n[\n  {\"e\": 5}\n]\n";
+        let out = normalize_to_ndjson(&DecodeFormat::Json, BytesMut::from(raw)).unwrap();
+        assert_eq!(
+            std::str::from_utf8(&out).unwrap(),
+            "{\"a\":1}\n{\"b\":{\"c\":[1,2]}}\n{\"d\":\"x\\ny\"}\n{\"e\":5}\n"
+        );
+    }
+
+    #[test]
+    fn utf8_policies() {
+        let input: &[u8] = b"{\"a\":\"ok\"}\n{\"a\":\"n\x00ul\"}\n{\"a\":\"b\xffad\"}\n";
+
+        let rejected = apply_utf8_policy(&InvalidUtf8::Reject, BytesMut::from(input));
+        assert_eq!(&rejected[..], b"{\"a\":\"ok\"}\n");
+
+        let replaced = apply_utf8_policy(&InvalidUtf8::Replace, BytesMut::from(input));
+        assert_eq!(
+            std::str::from_utf8(&replaced).unwrap(),
+            "{\"a\":\"ok\"}\n{\"a\":\"nul\"}\n{\"a\":\"b\u{FFFD}ad\"}\n"
+        );
+
+        let passed = apply_utf8_policy(&InvalidUtf8::Passthrough, BytesMut::from(input));
+        assert_eq!(&passed[..], input);
+    }
+
+    #[test]
+    fn ndjson_input_is_unchanged_apart_from_leading_space() {
+        let out = normalize_to_ndjson(
+            &DecodeFormat::Ndjson,
+            BytesMut::from("\n{\"a\":[1]}\n{\"b\":2}"),
+        )
+        .unwrap();
+        assert_eq!(&out[..], b"{\"a\":[1]}\n{\"b\":2}\n");
+    }
+}
@@ -1,5 +1,4 @@
 use anyhow::Result;
-use bytes::BytesMut;
 use std::path::PathBuf;
 use std::sync::Arc;
 use tangent_shared::dag::NodeRef;
@@ -10,7 +9,6 @@ use tokio_util::sync::CancellationToken;
 
 use crate::router::Router;
 use crate::sources::decoding;
-use crate::sources::decoding::normalize_to_ndjson;
 
 pub async fn run_consumer(
     name: Arc<str>,
@@ -25,17 +23,16 @@ pub async fn run_consumer(
     let mut f = File::open(&path).await?;
     let mut buf = Vec::new();
     f.read_to_end(&mut buf).await?;
-    let buf = BytesMut::from(&buf[..]);
 
     let sniff = &buf[..buf.len().min(8)];
     let comp = dc.resolve_compression(None, path.file_name().and_then(|s| s.to_str()), sniff);
-    let raw = decoding::decompress_bytes(&comp, buf)?;
-
-    let mut ndjson = normalize_to_ndjson(&cfg.decoding.format, raw)?;
-    let frames = decoding::chunk_ndjson(&mut ndjson, chunks);
-
     let from = NodeRef::Source { name: name };
-    router.forward(&from, frames, Vec::new()).await?;
+    let blocks = decoding::BlockDecoder::new(&dc, &comp, &buf, decoding::DECODE_BLOCK_BYTES)?;
+    for block in blocks {
+        let mut ndjson = block?;
+        let frames = decoding::chunk_ndjson(&mut ndjson, chunks);
+        router.forward(&from, frames, Vec::new()).await?;
+    }
 
     let () = shutdown.cancelled().await;
     Ok(())
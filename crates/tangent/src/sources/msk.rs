@@ -9,7 +9,7 @@ use std::sync::{Arc, Mutex};
 use std::time::Duration;
 use tokio_util::sync::CancellationToken;
 
-use crate::{router::Router, sources::decoding::normalize_to_ndjson};
+use crate::router::Router;
 use rdkafka::message::Headers;
 use tangent_shared::{
     dag::NodeRef,
@@ -119,12 +119,14 @@ pub async fn run_consumer(
                             let sniff     = &p[..std::cmp::min(8, p.len())];
                             let comp = dc.resolve_compression(meta_ce, filename, sniff);
 
-                            let raw = decoding::decompress_vec(&comp, p)?;
-
-                            let mut ndjson = normalize_to_ndjson(&kc.decoding.format, raw)?;
-                            let frames_mut = decoding::chunk_ndjson(&mut ndjson, chunks);
-
-                            router.forward(&from, frames_mut, vec![]).await?;
+                            let blocks = decoding::BlockDecoder::new(
+                                &dc, &comp, p, decoding::DECODE_BLOCK_BYTES,
+                            )?;
+                            for block in blocks {
+                                let mut ndjson = block?;
+                                let frames_mut = decoding::chunk_ndjson(&mut ndjson, chunks);
+                                router.forward(&from, frames_mut, vec![]).await?;
+                            }
                         }
                     }
                     Err(e) => {
@@ -11,14 +11,16 @@ use tokio::task::JoinSet;
 use tokio_util::sync::CancellationToken;
 
 use crate::router::Router;
+use crate::sources::decoding;
+use tangent_shared::sources::common::InvalidUtf8;
 use tangent_shared::sources::socket::SocketConfig;
 
-fn drain_ndjson_lines(buf: &mut BytesMut) -> Vec<BytesMut> {
+fn drain_ndjson_lines(buf: &mut BytesMut, policy: &InvalidUtf8) -> Vec<BytesMut> {
     let mut out = Vec::with_capacity(500);
 
     while let Some(nl) = memchr(b'\n', &buf[..]) {
         let line = buf.split_to(nl + 1);
-        out.push(line);
+        out.extend(decoding::clean_line_with(policy, line));
     }
 
     out
@@ -49,6 +51,7 @@ pub async fn run_consumer(
                 let from = from.clone();
                 let router = router.clone();
                 let shutdown2 = shutdown.clone();
+                let policy = cfg.invalid_utf8.clone();
 
                 js.spawn(async move {
                     let mut buf = BytesMut::with_capacity(read_buf_cap);
@@ -61,13 +64,13 @@ pub async fn run_consumer(
                                 Ok(0) => {
                                     if !buf.is_empty() {
                                         if !buf.ends_with(b"\n") { buf.extend_from_slice(b"\n"); }
-                                        let frames = drain_ndjson_lines(&mut buf);
+                                        let frames = drain_ndjson_lines(&mut buf, &policy);
                                         let _ = router.forward(&from, frames, Vec::new()).await;
                                     }
                                     break;
                                 }
                                 Ok(_n) => {
-                                    let frames = drain_ndjson_lines(&mut buf);
+                                    let frames = drain_ndjson_lines(&mut buf, &policy);
                                     if !frames.is_empty() {
                                         if let Err(e) = router.forward(&from, frames, Vec::new()).await {
                                             let _ = err_tx.send(e).await;
@@ -73,7 +73,7 @@ pub async fn run_consumer(
                                                             let bytes = collected.into_bytes();
                                                             let raw = BytesMut::from(bytes.as_ref());
 
-                                                            let mut ndjson = decoding::normalize_to_ndjson(&cfg.decoding.format, raw)?;
+                                                            let mut ndjson = decoding::apply_utf8_policy(&cfg.decoding.invalid_utf8, decoding::normalize_to_ndjson(&cfg.decoding.format, raw)?);
                                                             frames_all.extend(decoding::chunk_ndjson(&mut ndjson, chunks));
                                                         }
                                                         Err(e) => {
@@ -104,7 +104,7 @@ pub async fn run_consumer(
                                     }
                                 };
 
-                                let mut ndjson = decoding::normalize_to_ndjson(&cfg.decoding.format, raw)?;
+                                let mut ndjson = decoding::apply_utf8_policy(&cfg.decoding.invalid_utf8, decoding::normalize_to_ndjson(&cfg.decoding.format, raw)?);
                                 frames_all.extend(decoding::chunk_ndjson(&mut ndjson, chunks));
                             }
 
@@ -11,14 +11,54 @@ use tokio::task::JoinSet;
 use tokio_util::sync::CancellationToken;
 
 use crate::router::Router;
+use crate::sources::decoding;
+use tangent_shared::sources::common::InvalidUtf8;
 use tangent_shared::sources::tcp::TcpConfig;
 
-fn drain_ndjson_lines(buf: &mut BytesMut) -> Vec<BytesMut> {
+/// Splits complete lines off `buf`. A partial line longer than `max_line` is
+/// discarded, and `skipping` stays set until its terminating newline arrives.
+fn drain_ndjson_lines(
+    buf: &mut BytesMut,
+    skipping: &mut bool,
+    max_line: usize,
+    policy: &InvalidUtf8,
+) -> Vec<BytesMut> {
     let mut out = Vec::with_capacity(500);
 
+    if *skipping {
+        match memchr(b'\n', &buf[..]) {
+            Some(nl) => {
+                let _ = buf.split_to(nl + 1);
+                *skipping = false;
+            }
+            None => {
+                buf.clear();
+                return out;
+            }
+        }
+    }
+
     while let Some(nl) = memchr(b'\n', &buf[..]) {
         let line = buf.split_to(nl + 1);
-        out.push(line);
+        if nl > max_line {
+            tracing::warn!(
+                bytes = nl,
+                max_line,
+                "tcp record exceeds max_line_bytes; dropping it"
+            );
+            continue;
+        }
+        out.extend(decoding::clean_line_with(policy, line));
+    }
+
+    if buf.len() > max_line {
+        tracing::warn!(
+            bytes = buf.len(),
+            max_line,
+            "tcp record exceeds max_line_bytes; dropping it"
+        );
+        buf.clear();
+        *skipping = true;
     }
 
     out
@@ -33,6 +73,8 @@ pub async fn run_consumer(
     let listener = TcpListener::bind(cfg.bind_address).await?;
 
     let read_buf_cap = cfg.read_buffer_size.max(8 * 1024);
+    let max_line = cfg.max_line_bytes;
+    let policy = cfg.invalid_utf8;
 
     let (err_tx, mut err_rx) = mpsc::channel::<anyhow::Error>(64);
 
@@ -62,8 +104,10 @@ pub async fn run_consumer(
                 let from = from.clone();
 
                 let shutdown2 = shutdown.clone();
+                let policy = policy.clone();
                 js.spawn(async move {
                     let mut buf = BytesMut::with_capacity(read_buf_cap);
+                    let mut skipping = false;
 
                     loop {
                         tokio::select! {
@@ -75,7 +119,7 @@ pub async fn run_consumer(
                                             if !buf.ends_with(b"\n") {
                                                 buf.extend_from_slice(b"\n");
                                             }
-                                            let frames = drain_ndjson_lines(&mut buf);
+                                            let frames = drain_ndjson_lines(&mut buf, &mut skipping, max_line, &policy);
                                             if let Err(e) = rtr
                                                 .forward(&from, frames, Vec::new())
                                                 .await
@@ -86,7 +130,7 @@ pub async fn run_consumer(
                                         break;
                                     }
                                     Ok(_) => {
-                                        let frames = drain_ndjson_lines(&mut buf);
+                                        let frames = drain_ndjson_lines(&mut buf, &mut skipping, max_line, &policy);
                                         if !frames.is_empty() {
                                             if let Err(e) = rtr
                                             .forward(&from, frames, Vec::new())
@@ -130,3 +174,55 @@ pub async fn run_consumer(
 
     Ok(())
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn oversized_record_in_small_chunks_is_dropped_cleanly() {
+        let max_line = 64 * 1024;
+        let mut big = vec![b'x'; 5 * 1024 * 1024];
+        big.push(b'\n');
+        let mut input = b"{\"a\":1}\n".to_vec();
+        input.extend(big);
+        input.extend_from_slice(b"{\"b\":2}\n");
+
+        let mut buf = BytesMut::new();
+        let mut skipping = false;
+        let mut lines = Vec::new();
+        for chunk in input.chunks(4096) {
+            buf.extend_from_slice(chunk);
+            lines.extend(drain_ndjson_lines(
+                &mut buf,
+                &mut skipping,
+                max_line,
+                &InvalidUtf8::Passthrough,
+            ));
+            assert!(buf.len() <= max_line + 4096);
+        }
+
+        assert_eq!(lines, vec![&b"{\"a\":1}\n"[..], &b"{\"b\":2}\n"[..]]);
+        assert!(!skipping);
+    }
+
+    #[test]
+    fn lines_follow_the_invalid_utf8_policy() {
+        let input: &[u8] = b"{\"a\":\"ok\"}\n{\"a\":\"b\xffad\"}\r\n{\"a\":\"n\x00ul\"}\n";
+        let drain = |policy| {
+            let mut buf = BytesMut::from(input);
+            drain_ndjson_lines(&mut buf, &mut false, 1024, &policy)
+        };
+
+        assert_eq!(drain(InvalidUtf8::Reject), vec![&b"{\"a\":\"ok\"}\n"[..]]);
+        assert_eq!(
+            drain(InvalidUtf8::Replace),
+            vec![
+                "{\"a\":\"ok\"}\n".as_bytes(),
+                "{\"a\":\"b\u{FFFD}ad\"}\n".as_bytes(),
+                "{\"a\":\"nul\"}\n".as_bytes(),
+            ]
+        );
+        assert_eq!(drain(InvalidUtf8::Passthrough).len(), 3);
+    }
+}
@@ -0,0 +1,311 @@
+use anyhow::{bail, Result};
+use bytes::{BufMut, BytesMut};
+use serde_json::{Map, Number, Value};
+
+use crate::ZEEK_TSV_DROPPED_ROWS_TOTAL;
+
+const DEFAULT_SEPARATOR: &str = "\t";
+const DEFAULT_SET_SEPARATOR: &str = ",";
+const DEFAULT_EMPTY_FIELD: &str = "(empty)";
+const DEFAULT_UNSET_FIELD: &str = "-";
+
+/// Header state. Directives may repeat mid-input (rotated logs concatenated
+/// into one object), so each one replaces what came before.
+struct Header {
+    separator: String,
+    set_separator: String,
+    empty_field: String,
+    unset_field: String,
+    path: Option<String>,
+    fields: Vec<String>,
+    types: Vec<String>,
+}
+
+impl Default for Header {
+    fn default() -> Self {
+        Self {
+            separator: DEFAULT_SEPARATOR.to_string(),
+            set_separator: DEFAULT_SET_SEPARATOR.to_string(),
+            empty_field: DEFAULT_EMPTY_FIELD.to_string(),
+            unset_field: DEFAULT_UNSET_FIELD.to_string(),
+            path: None,
+            fields: Vec::new(),
+            types: Vec::new(),
+        }
+    }
+}
+
+impl Header {
+    fn directive(&mut self, line: &str) {
+        // #separator is space-delimited, since it defines the delimiter for
+        // the rest.
+        if let Some(sep) = line.strip_prefix("#separator ") {
+            self.separator = unescape(sep);
+            return;
+        }
+        let mut parts = line[1..].split(self.separator.as_str());
+        let Some(name) = parts.next() else {
+            return;
+        };
+        match name {
+            "set_separator" => self.set_separator = unescape(parts.next().unwrap_or_default()),
+            "empty_field" => self.empty_field = unescape(parts.next().unwrap_or_default()),
+            "unset_field" => self.unset_field = unescape(parts.next().unwrap_or_default()),
+            "path" => self.path = parts.next().map(unescape),
+            "fields" => self.fields = parts.map(str::to_owned).collect(),
+            "types" => self.types = parts.map(str::to_owned).collect(),
+            _ => {} // #open, #close
+        }
+    }
+
+    fn record(&self, line: &str) -> Option<Value> {
+        let values: Vec<&str> = line.split(self.separator.as_str()).collect();
+        if values.len() != self.fields.len() {
+            return None;
+        }
+
+        let mut rec = Map::new();
+        if let Some(path) = &self.path {
+            rec.insert("_path".to_string(), Value::String(path.clone()));
+        }
+        for (i, (field, raw)) in self.fields.iter().zip(values).enumerate() {
+            if raw == self.unset_field {
+                continue;
+            }
+            let typ = self.types.get(i).map_or("string", String::as_str);
+            let value = match is_container(typ) {
+                true if raw == self.empty_field => Value::Array(Vec::new()),
+                true => Value::Array(
+                    raw.split(self.set_separator.as_str())
+                        .map(|v| Value::String(unescape(v)))
+                        .collect(),
+                ),
+                false if raw == self.empty_field => Value::String(String::new()),
+                false => scalar(typ, raw),
+            };
+            rec.insert(field.clone(), value);
+        }
+        Some(Value::Object(rec))
+    }
+}
+
+/// Reports whether `typ` is `set[T]` or `vector[T]`. Their elements are
+/// kept as strings whatever T is.
+fn is_container(typ: &str) -> bool {
+    (typ.starts_with("set[") || typ.starts_with("vector[")) && typ.ends_with(']')
+}
+
+/// Converts one value as the JSON writer would: times and intervals as
+/// float seconds, counts and ports as integers, bools as booleans and
+/// everything else as a string. A value that doesn't parse as its declared
+/// type is kept as a string.
+fn scalar(typ: &str, raw: &str) -> Value {
+    let s = unescape(raw);
+    let parsed = match typ {
+        "time" | "interval" | "double" => s
+            .parse::<f64>()
+            .ok()
+            .and_then(Number::from_f64)
+            .map(Value::Number),
+        "count" | "port" => s.parse::<u64>().ok().map(Value::from),
+        "int" => s.parse::<i64>().ok().map(Value::from),
+        "bool" => match s.as_str() {
+            "T" => Some(Value::Bool(true)),
+            "F" => Some(Value::Bool(false)),
+            _ => None,
+        },
+        _ => None,
+    };
+    parsed.unwrap_or(Value::String(s))
+}
+
+/// Undoes the ASCII writer's escaping: `\xHH` for separators, unprintable
+/// bytes and values that would read as unset or empty, and `\\` for a
+/// backslash.
+fn unescape(s: &str) -> String {
+    if !s.contains('\\') {
+        return s.to_string();
+    }
+    let b = s.as_bytes();
+    let mut out = Vec::with_capacity(b.len());
+    let mut i = 0;
+    while i < b.len() {
+        if b[i] == b'\\' {
+            if b.get(i + 1) == Some(&b'\\') {
+                out.push(b'\\');
+                i += 2;
+                continue;
+            }
+            if b.get(i + 1) == Some(&b'x') {
+                if let Some(byte) = s
+                    .get(i + 2..i + 4)
+                    .and_then(|h| u8::from_str_radix(h, 16).ok())
+                {
+                    out.push(byte);
+                    i += 4;
+                    continue;
+                }
+            }
+        }
+        out.push(b[i]);
+        i += 1;
+    }
+    String::from_utf8_lossy(&out).into_owned()
+}
+
+/// Converts a Zeek ASCII (TSV) log to NDJSON, one record per data row, in
+/// the shape Zeek's JSON writer emits so the same mappers read both. `_path`
+/// comes from the `#path` directive, and set and vector values become
+/// string arrays. Rows whose column count doesn't match `#fields` are
+/// dropped, counted in `tangent_zeek_tsv_dropped_rows_total`.
+pub fn zeek_tsv_to_ndjson(data: &[u8]) -> Result<BytesMut> {
+    let text = String::from_utf8_lossy(data);
+    let mut header = Header::default();
+    let mut buf = BytesMut::new();
+
+    for (i, line) in text.lines().enumerate() {
+        if line.is_empty() {
+            continue;
+        }
+        if line.starts_with('#') {
+            header.directive(line);
+            continue;
+        }
+        if header.fields.is_empty() {
+            bail!("zeek tsv row at line {} has no #fields header", i + 1);
+        }
+        match header.record(line) {
+            Some(rec) => {
+                serde_json::to_writer((&mut buf).writer(), &rec)?;
+                buf.put_u8(b'\n');
+            }
+            None => {
+                ZEEK_TSV_DROPPED_ROWS_TOTAL.inc();
+                tracing::warn!(
+                    line = i + 1,
+                    "dropping zeek tsv row: column count does not match #fields"
+                )
+            }
+        }
+    }
+    Ok(buf)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    const CONN_LOG: &str = include_str!("testdata/zeek_conn.log");
+    const DNS_LOG: &str = include_str!("testdata/zeek_dns.log");
+
+    fn records(data: &str) -> Vec<Value> {
+        let out = zeek_tsv_to_ndjson(data.as_bytes()).unwrap();
+        out[..]
+            .split(|b| *b == b'\n')
+            .filter(|l| !l.is_empty())
+            .map(|l| serde_json::from_slice(l).unwrap())
+            .collect()
+    }
+
+    #[test]
+    fn conn_log_matches_the_json_writer() {
+        let recs = records(CONN_LOG);
+        assert_eq!(recs.len(), 4);
+        assert_eq!(
+            recs[0],
+            json!({
+                "_path": "conn",
+                "ts": 1729051621.489,
+                "uid": "CmRFd61N7G7YA909D1",
+                "id.orig_h": "10.4.30.5",
+                "id.orig_p": 49227,
+                "id.resp_h": "37.120.182.208",
+                "id.resp_p": 80,
+                "proto": "tcp",
+                "service": "http",
+                "duration": 0.065,
+                "orig_bytes": 164,
+                "resp_bytes": 213,
+                "conn_state": "SF",
+                "local_orig": true,
+                "local_resp": false,
+                "missed_bytes": 0,
+                "history": "ShADadfF",
+                "orig_pkts": 6,
+                "orig_ip_bytes": 416,
+                "resp_pkts": 5,
+                "resp_ip_bytes": 417,
+                "tunnel_parents": []
+            })
+        );
+
+        // Unset fields are left out, as the JSON writer does.
+        for field in ["service", "duration", "orig_bytes", "resp_bytes"] {
+            assert!(recs[2].get(field).is_none(), "{field}");
+        }
+        assert_eq!(
+            recs[3]["tunnel_parents"],
+            json!(["C2y6XKB2ovrcvv1G5", "CQ8pfn1xJ3rVUaeVDh"])
+        );
+        assert!(recs[3].get("history").is_none());
+    }
+
+    #[test]
+    fn dns_log_vectors_become_string_arrays() {
+        let recs = records(DNS_LOG);
+        assert_eq!(recs.len(), 4);
+        assert_eq!(
+            recs[1]["answers"],
+            json!([
+                "www.example.com-v4.edgesuite.net",
+                "a1422.dscr.akamai.net",
+                "93.184.215.14"
+            ])
+        );
+        assert_eq!(
+            recs[1]["TTLs"],
+            json!(["1800.000000", "1800.000000", "20.000000"])
+        );
+        assert_eq!(recs[1]["qtype"], json!(1));
+        assert_eq!(recs[1]["RD"], json!(true));
+
+        let unanswered = &recs[2];
+        for field in ["rtt", "rcode", "rcode_name", "answers", "TTLs"] {
+            assert!(unanswered.get(field).is_none(), "{field}");
+        }
+        assert_eq!(recs[3]["rcode_name"], json!("NXDOMAIN"));
+    }
+
+    #[test]
+    fn honours_header_directives_and_escapes() {
+        let log = "#separator \\x7c\n\
+                   #set_separator|;\n\
+                   #empty_field|EMPTY\n\
+                   #unset_field|NONE\n\
+                   #path|weird\n\
+                   #fields|name|addl|notice|tags|peer\n\
+                   #types|string|string|bool|set[string]|string\n\
+                   bad\\x7cname|\\x2d|F|a;b|NONE\n\
+                   x|EMPTY|T|EMPTY|-\n\
+                   short|row\n";
+        let dropped = ZEEK_TSV_DROPPED_ROWS_TOTAL.get();
+        assert_eq!(
+            records(log),
+            vec![
+                json!({"_path": "weird", "name": "bad|name", "addl": "-", "notice": false, "tags": ["a", "b"]}),
+                json!({"_path": "weird", "name": "x", "addl": "", "notice": true, "tags": [], "peer": "-"}),
+            ]
+        );
+        assert!(ZEEK_TSV_DROPPED_ROWS_TOTAL.get() > dropped);
+    }
+
+    #[test]
+    fn rows_need_a_fields_header() {
+        let err = zeek_tsv_to_ndjson(b"1729051621.489\tCmRFd61N7G7YA909D1\n").unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "zeek tsv row at line 1 has no #fields header"
+        );
+    }
+}
@@ -11,17 +11,25 @@ use wasmtime_wasi::WasiCtxBuilder;
 
 use crate::cache::CacheHandle;
 use crate::wasm::host::tangent::logs::{cache, config, lock, log, remote};
-use crate::wasm::host::{HostEngine, Processor};
+use crate::wasm::host::{HostAllowlist, HostEngine, Processor};
 pub struct WasmEngine {
     engine: Engine,
     linker: Linker<HostEngine>,
     cache: std::sync::Arc<CacheHandle>,
     config: HashMap<Arc<str>, Arc<HashMap<String, Value>>>,
+    allowed_hosts: HashMap<Arc<str>, Arc<HostAllowlist>>,
     disable_remote_calls: bool,
+    remote_max_concurrency: usize,
+    remote_max_response_bytes: u64,
 }
 
 impl WasmEngine {
-    pub fn new(cache: std::sync::Arc<CacheHandle>, disable_remote_calls: bool) -> Result<Self> {
+    pub fn new(
+        cache: std::sync::Arc<CacheHandle>,
+        disable_remote_calls: bool,
+        remote_max_concurrency: usize,
+        remote_max_response_bytes: u64,
+    ) -> Result<Self> {
         let engine = tangent_shared::wasm_engine::build()?;
         let mut linker = Linker::<HostEngine>::new(&engine);
         wasmtime_wasi::p2::add_to_linker_async(&mut linker)?;
@@ -36,7 +44,10 @@ impl WasmEngine {
             linker,
             cache,
             disable_remote_calls,
+            remote_max_concurrency,
+            remote_max_response_bytes,
             config: HashMap::new(),
+            allowed_hosts: HashMap::new(),
         })
     }
 
@@ -49,9 +60,15 @@ impl WasmEngine {
         name: Arc<str>,
         loc: &Path,
         cfg: HashMap<String, Value>,
+        allowed_hosts: Option<&[String]>,
     ) -> Result<Component> {
         let comp = unsafe { Component::deserialize_file(&self.engine, &loc)? };
 
+        if let Some(patterns) = allowed_hosts {
+            self.allowed_hosts
+                .insert(name.clone(), Arc::new(HostAllowlist::new(patterns)));
+        }
+
         self.config.insert(name, Arc::new(cfg));
 
         Ok(comp)
@@ -66,9 +83,13 @@ impl WasmEngine {
                     .inherit_stderr()
                     .inherit_env()
                     .build(),
+                component_name.clone(),
                 self.cache.clone(),
                 self.config.get(component_name).unwrap().clone(),
+                self.allowed_hosts.get(component_name).cloned(),
                 self.disable_remote_calls,
+                self.remote_max_concurrency,
+                self.remote_max_response_bytes,
             ),
         )
     }
@@ -4,6 +4,7 @@ use ahash::HashMap;
 use ahash::HashMapExt;
 use anyhow::Result;
 use bytes::{Bytes, BytesMut};
+use futures::stream::{self, StreamExt};
 use once_cell::sync::Lazy;
 use parking_lot::Mutex;
 use reqwest::Client;
@@ -19,6 +20,7 @@ use wasmtime_wasi::{WasiCtx, WasiCtxView, WasiView};
 use crate::cache::CacheHandle;
 use crate::wasm::host::tangent::logs::log;
 use crate::wasm::host::tangent::logs::remote;
+use crate::CACHE_OPS_TOTAL;
 use log::Scalar;
 
 static LOCKS: Lazy<Mutex<HashMap<String, bool>>> = Lazy::new(|| Mutex::new(HashMap::new()));
@@ -37,32 +39,48 @@ bindgen!({
 
 pub struct HostEngine {
     pub ctx: WasiCtx,
+    plugin: Arc<str>,
     pub table: ResourceTable,
     http_client: Client,
     cache: Arc<CacheHandle>,
     plugin_cfg: Arc<HashMap<String, JSONValue>>,
+    allowed_hosts: Option<Arc<HostAllowlist>>,
     /// If true, short-circuit remote calls with successful empty responses.
     pub disable_remote_calls: bool,
+    remote_max_concurrency: usize,
+    remote_max_response_bytes: u64,
 }
 
 impl HostEngine {
     pub fn new(
         ctx: WasiCtx,
+        plugin: Arc<str>,
         cache: Arc<CacheHandle>,
         config: Arc<HashMap<String, JSONValue>>,
+        allowed_hosts: Option<Arc<HostAllowlist>>,
         disable_remote_calls: bool,
+        remote_max_concurrency: usize,
+        remote_max_response_bytes: u64,
     ) -> Self {
         Self {
             ctx,
+            plugin,
             table: ResourceTable::new(),
-            http_client: Client::new(),
+            http_client: remote_client(allowed_hosts.clone()),
             cache,
             plugin_cfg: config,
+            allowed_hosts,
             disable_remote_calls,
+            remote_max_concurrency: remote_max_concurrency.max(1),
+            remote_max_response_bytes,
         }
     }
 
-    async fn execute_single(client: Client, r: remote::Request) -> remote::Response {
+    async fn execute_single(
+        client: Client,
+        r: remote::Request,
+        default_max_response_bytes: u64,
+    ) -> remote::Response {
         use remote::Method;
 
         let method = match r.method {
@@ -75,10 +93,36 @@ impl HostEngine {
 
         let mut req_builder = client.request(method, &r.url);
 
+        let mut max_response_bytes = default_max_response_bytes;
         for (name, value) in &r.headers {
+            if name.eq_ignore_ascii_case(MAX_RESPONSE_BYTES_HEADER) {
+                match value.trim().parse::<i64>() {
+                    Ok(n) => max_response_bytes = response_limit(n, default_max_response_bytes),
+                    Err(e) => {
+                        return remote::Response {
+                            id: r.id,
+                            status: 0,
+                            headers: Vec::new(),
+                            body: Vec::new(),
+                            error: Some(format!("invalid {MAX_RESPONSE_BYTES_HEADER}: {e}")),
+                        }
+                    }
+                }
+                continue;
+            }
             req_builder = req_builder.header(name.as_str(), value.as_str());
         }
 
+        // Unless the guest negotiates encodings itself, ask for gzip and hand
+        // back the decoded body so callers never see compressed bytes.
+        let host_decodes = !r
+            .headers
+            .iter()
+            .any(|(name, _)| name.eq_ignore_ascii_case("accept-encoding"));
+        if host_decodes {
+            req_builder = req_builder.header(reqwest::header::ACCEPT_ENCODING, "gzip");
+        }
+
         if let Some(ms) = r.timeout_ms {
             req_builder = req_builder.timeout(std::time::Duration::from_millis(ms as u64));
         }
@@ -90,31 +134,73 @@ impl HostEngine {
         match req_builder.send().await {
             Ok(res) => {
                 let status = res.status().as_u16();
-                let headers = res
+                let gunzip = host_decodes
+                    && res
+                        .headers()
+                        .get(reqwest::header::CONTENT_ENCODING)
+                        .is_some_and(|v| v.as_bytes().eq_ignore_ascii_case(b"gzip"));
+                let mut headers = res
                     .headers()
                     .iter()
                     .map(|(k, v)| (k.to_string(), v.to_str().unwrap_or_default().to_string()))
                     .collect::<Vec<(String, String)>>();
 
-                let body_bytes = match res.bytes().await {
-                    Ok(b) => b.to_vec(),
+                let (raw, cut) = match read_capped(res, max_response_bytes).await {
+                    Ok(read) => read,
                     Err(e) => {
                         return remote::Response {
                             id: r.id,
                             status,
                             headers,
                             body: Vec::new(),
-                            error: Some(format!("failed to read body: {e}")),
+                            error: Some(if e.is_timeout() {
+                                remote_error(&e)
+                            } else {
+                                format!("failed to read body: {e}")
+                            }),
                         }
                     }
                 };
 
-                remote::Response {
-                    id: r.id,
-                    status,
-                    headers,
-                    body: body_bytes,
-                    error: None,
+                // A cut-off gzip stream can't be decoded, so it goes back raw
+                // with the encoding headers that describe it.
+                if !gunzip || cut {
+                    if cut {
+                        mark_truncated(&mut headers);
+                    }
+                    return remote::Response {
+                        id: r.id,
+                        status,
+                        headers,
+                        body: raw,
+                        error: None,
+                    };
+                }
+
+                match gunzip_body(&raw, max_response_bytes) {
+                    Ok((body, truncated)) => {
+                        headers.retain(|(k, _)| {
+                            !k.eq_ignore_ascii_case("content-encoding")
+                                && !k.eq_ignore_ascii_case("content-length")
+                        });
+                        if truncated {
+                            mark_truncated(&mut headers);
+                        }
+                        remote::Response {
+                            id: r.id,
+                            status,
+                            headers,
+                            body,
+                            error: None,
+                        }
+                    }
+                    Err(e) => remote::Response {
+                        id: r.id,
+                        status,
+                        headers,
+                        body: raw,
+                        error: Some(format!("failed to decode gzip body: {e}")),
+                    },
                 }
             }
             Err(e) => remote::Response {
@@ -122,12 +208,153 @@ impl HostEngine {
                 status: 0,
                 headers: Vec::new(),
                 body: Vec::new(),
-                error: Some(e.to_string()),
+                error: Some(remote_error(&e)),
             },
         }
     }
 }
 
+/// Hosts a plugin may reach through remote calls. Patterns are exact hostnames
+/// or `*.suffix` wildcards; a wildcard does not match the bare suffix.
+#[derive(Debug, Clone)]
+pub struct HostAllowlist {
+    patterns: Vec<String>,
+}
+
+impl HostAllowlist {
+    pub fn new(patterns: &[String]) -> Self {
+        Self {
+            patterns: patterns
+                .iter()
+                .map(|p| p.trim().trim_end_matches('.').to_ascii_lowercase())
+                .collect(),
+        }
+    }
+
+    /// Checks the host the request would actually connect to. The URL is
+    /// parsed the same way reqwest parses it, so userinfo such as
+    /// `https://allowed.com@evil.com/` resolves to `evil.com`.
+    pub fn check(&self, url: &str) -> Result<(), String> {
+        let parsed = reqwest::Url::parse(url).map_err(|e| format!("invalid url {url}: {e}"))?;
+        let host = parsed
+            .host_str()
+            .ok_or_else(|| format!("{HOST_NOT_ALLOWED_PREFIX}{url} has no host"))?
+            .trim_end_matches('.')
+            .to_ascii_lowercase();
+
+        let allowed = self.patterns.iter().any(|p| match p.strip_prefix("*.") {
+            Some(suffix) => host
+                .strip_suffix(suffix)
+                .is_some_and(|rest| rest.ends_with('.')),
+            None => *p == host,
+        });
+        if allowed {
+            Ok(())
+        } else {
+            Err(format!("{HOST_NOT_ALLOWED_PREFIX}{host}"))
+        }
+    }
+}
+
+/// Builds the client for a plugin's remote calls. With an allowlist, every
+/// redirect hop is checked too, so an allowed host can't bounce a request
+/// (and, on a 307, its body) to one that isn't.
+fn remote_client(allowed_hosts: Option<Arc<HostAllowlist>>) -> Client {
+    let Some(allow) = allowed_hosts else {
+        return Client::new();
+    };
+    Client::builder()
+        .redirect(reqwest::redirect::Policy::custom(move |attempt| {
+            if attempt.previous().len() >= MAX_REDIRECTS {
+                return attempt.error("too many redirects");
+            }
+            match allow.check(attempt.url().as_str()) {
+                Ok(()) => attempt.follow(),
+                Err(e) => attempt.error(e),
+            }
+        }))
+        .build()
+        .expect("building remote client")
+}
+
+/// reqwest's default redirect limit, kept for allowlisted clients.
+const MAX_REDIRECTS: usize = 10;
+
+/// Prefix on `response.error` when a plugin's allowed_hosts rejected the URL.
+const HOST_NOT_ALLOWED_PREFIX: &str = "host not allowed: ";
+
+/// Prefix on `response.error` when a request exceeded its `timeout-ms`, so
+/// guests can tell a slow upstream apart from other failures.
+const REMOTE_TIMEOUT_PREFIX: &str = "timeout: ";
+
+/// Request header a guest sets to override `remote_max_response_bytes` for
+/// one call. The host consumes it rather than sending it upstream.
+const MAX_RESPONSE_BYTES_HEADER: &str = "x-tangent-max-response-bytes";
+
+/// Response header the host adds, set to `true`, when the body stopped at
+/// the response size limit.
+const TRUNCATED_HEADER: &str = "x-tangent-truncated";
+
+fn mark_truncated(headers: &mut Vec<(String, String)>) {
+    headers.push((TRUNCATED_HEADER.to_string(), "true".to_string()));
+}
+
+/// Resolves a request's max-response-bytes: 0 takes the runtime default and
+/// a negative value lifts the limit.
+fn response_limit(requested: i64, default: u64) -> u64 {
+    match requested {
+        0 => default,
+        n if n < 0 => u64::MAX,
+        n => n as u64,
+    }
+}
+
+/// Reads at most `max` bytes of the body, reporting whether more remained.
+async fn read_capped(mut res: reqwest::Response, max: u64) -> reqwest::Result<(Vec<u8>, bool)> {
+    let mut out = Vec::new();
+    while let Some(chunk) = res.chunk().await? {
+        let room = max.saturating_sub(out.len() as u64) as usize;
+        if chunk.len() > room {
+            out.extend_from_slice(&chunk[..room]);
+            return Ok((out, true));
+        }
+        out.extend_from_slice(&chunk);
+    }
+    Ok((out, false))
+}
+
+/// Decodes a gzip body, stopping at `max` decoded bytes so a small
+/// compressed payload can't expand without bound.
+fn gunzip_body(data: &[u8], max: u64) -> std::io::Result<(Vec<u8>, bool)> {
+    use std::io::Read;
+
+    let mut out = Vec::new();
+    flate2::read::GzDecoder::new(data)
+        .take(max.saturating_add(1))
+        .read_to_end(&mut out)?;
+    let truncated = out.len() as u64 > max;
+    out.truncate(max as usize);
+    Ok((out, truncated))
+}
+
+fn remote_error(e: &reqwest::Error) -> String {
+    // A redirect the allowlist refused reports the same error as a refused
+    // initial URL.
+    if e.is_redirect() {
+        if let Some(msg) = std::error::Error::source(e)
+            .map(ToString::to_string)
+            .filter(|m| m.starts_with(HOST_NOT_ALLOWED_PREFIX))
+        {
+            return msg;
+        }
+    }
+    if e.is_timeout() {
+        format!("{REMOTE_TIMEOUT_PREFIX}{e}")
+    } else {
+        e.to_string()
+    }
+}
+
 impl WasiView for HostEngine {
     fn ctx(&mut self) -> WasiCtxView<'_> {
         WasiCtxView {
@@ -166,28 +393,54 @@ impl remote::Host for HostEngine {
         &mut self,
         reqs: Vec<remote::Request>,
     ) -> Result<Vec<remote::Response>, String> {
+        let allowed_hosts = self.allowed_hosts.clone();
+        let denied = move |r: &remote::Request| {
+            let err = allowed_hosts.as_ref()?.check(&r.url).err()?;
+            Some(remote::Response {
+                id: r.id.clone(),
+                status: 0,
+                headers: Vec::new(),
+                body: Vec::new(),
+                error: Some(err),
+            })
+        };
+
         if self.disable_remote_calls {
-            // Short-circuit with successful empty responses.
+            // Short-circuit with successful empty responses. The allowlist
+            // still applies so `tangent plugin test` catches violations.
             let out = reqs
                 .into_iter()
-                .map(|r| remote::Response {
-                    id: r.id,
-                    status: 204,
-                    headers: Vec::new(),
-                    body: Vec::new(),
-                    error: None,
+                .map(|r| {
+                    denied(&r).unwrap_or(remote::Response {
+                        id: r.id,
+                        status: 204,
+                        headers: Vec::new(),
+                        body: Vec::new(),
+                        error: None,
+                    })
                 })
                 .collect();
             return Ok(out);
         }
 
-        let mut out = Vec::with_capacity(reqs.len());
+        // `buffered` keeps responses in request order while letting up to
+        // remote_max_concurrency requests run at once.
         let client = self.http_client.clone();
-
-        for r in reqs {
-            let resp = Self::execute_single(client.clone(), r);
-            out.push(resp.await);
-        }
+        let max_response_bytes = self.remote_max_response_bytes;
+        let out = stream::iter(reqs)
+            .map(|r| {
+                let denied = denied(&r);
+                let client = client.clone();
+                async move {
+                    match denied {
+                        Some(resp) => resp,
+                        None => Self::execute_single(client, r, max_response_bytes).await,
+                    }
+                }
+            })
+            .buffered(self.remote_max_concurrency)
+            .collect()
+            .await;
 
         Ok(out)
     }
@@ -227,19 +480,170 @@ impl tangent::logs::lock::Host for HostEngine {
     }
 }
 
+impl HostEngine {
+    fn record_cache_op(&self, op: &str, result: &str, n: u64) {
+        if n > 0 {
+            CACHE_OPS_TOTAL
+                .with_label_values(&[&*self.plugin, op, result])
+                .inc_by(n);
+        }
+    }
+}
+
+fn write_result<T>(res: &anyhow::Result<T>) -> &'static str {
+    if res.is_ok() {
+        "ok"
+    } else {
+        "error"
+    }
+}
+
 impl tangent::logs::cache::Host for HostEngine {
     fn get(&mut self, key: String) -> Result<Option<Scalar>, String> {
-        self.cache.get(&key).map_err(|e| e.to_string())
+        let res = self.cache.get(&key);
+        match &res {
+            Ok(Some(_)) => self.record_cache_op("get", "hit", 1),
+            Ok(None) => self.record_cache_op("get", "miss", 1),
+            Err(_) => self.record_cache_op("get", "error", 1),
+        }
+        res.map_err(|e| e.to_string())
     }
 
     fn set(&mut self, key: String, value: Scalar, ttl_ms: Option<u64>) -> Result<(), String> {
-        self.cache
-            .set(&key, &value, ttl_ms)
-            .map_err(|e| e.to_string())
+        let res = self.cache.set(&key, &value, ttl_ms);
+        self.record_cache_op("set", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
     }
 
     fn del(&mut self, key: String) -> Result<bool, String> {
-        self.cache.del(&key).map_err(|e| e.to_string())
+        let res = self.cache.del(&key);
+        self.record_cache_op("del", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn ttl(&mut self, key: String) -> Result<Option<u64>, String> {
+        let res = self.cache.ttl(&key);
+        match &res {
+            Ok(Some(_)) => self.record_cache_op("ttl", "hit", 1),
+            Ok(None) => self.record_cache_op("ttl", "miss", 1),
+            Err(_) => self.record_cache_op("ttl", "error", 1),
+        }
+        res.map_err(|e| e.to_string())
+    }
+
+    fn expire(&mut self, key: String, ttl_ms: u64) -> Result<bool, String> {
+        let res = self.cache.expire(&key, ttl_ms);
+        self.record_cache_op("expire", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn get_many(&mut self, keys: Vec<String>) -> Result<Vec<(String, Scalar)>, String> {
+        let res = self.cache.get_many(&keys);
+        match &res {
+            Ok(found) => {
+                self.record_cache_op("get", "hit", found.len() as u64);
+                self.record_cache_op("get", "miss", (keys.len() - found.len()) as u64);
+            }
+            Err(_) => self.record_cache_op("get", "error", 1),
+        }
+        res.map_err(|e| e.to_string())
+    }
+
+    fn set_many(
+        &mut self,
+        entries: Vec<(String, Scalar)>,
+        ttl_ms: Option<u64>,
+    ) -> Result<(), String> {
+        let res = self.cache.set_many(&entries, ttl_ms);
+        self.record_cache_op("set", op_result(&res), entries.len() as u64);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn set_nx(&mut self, key: String, value: Scalar, ttl_ms: Option<u64>) -> Result<bool, String> {
+        let res = self.cache.set_nx(&key, &value, ttl_ms);
+        self.record_cache_op("set_nx", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn cas(
+        &mut self,
+        key: String,
+        expected: Option<Scalar>,
+        next: Scalar,
+        ttl_ms: Option<u64>,
+    ) -> Result<bool, String> {
+        let res = self.cache.cas(&key, expected.as_ref(), &next, ttl_ms);
+        self.record_cache_op("cas", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn incr(&mut self, key: String, delta: i64, ttl_ms: Option<u64>) -> Result<i64, String> {
+        let res = self.cache.incr(&key, delta, ttl_ms);
+        self.record_cache_op("incr", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn scan(
+        &mut self,
+        prefix: String,
+        after: Option<String>,
+        limit: u32,
+    ) -> Result<Vec<String>, String> {
+        let res = self.cache.scan(&prefix, after.as_deref(), limit);
+        self.record_cache_op("scan", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn push_list(
+        &mut self,
+        key: String,
+        values: Vec<String>,
+        ttl_ms: Option<u64>,
+    ) -> Result<(), String> {
+        let res = self.cache.push_list(&key, &values, ttl_ms);
+        self.record_cache_op("push_list", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn get_list(&mut self, key: String) -> Result<Vec<String>, String> {
+        let res = self.cache.get_list(&key);
+        self.record_cache_op("get_list", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn trim_list(&mut self, key: String, max: u32) -> Result<(), String> {
+        let res = self.cache.trim_list(&key, max);
+        self.record_cache_op("trim_list", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn add_to_set(
+        &mut self,
+        key: String,
+        member: String,
+        ttl_ms: Option<u64>,
+    ) -> Result<bool, String> {
+        let res = self.cache.add_to_set(&key, &member, ttl_ms);
+        self.record_cache_op("add_to_set", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn set_contains(&mut self, key: String, member: String) -> Result<bool, String> {
+        let res = self.cache.set_contains(&key, &member);
+        self.record_cache_op("set_contains", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn set_members(&mut self, key: String) -> Result<Vec<String>, String> {
+        let res = self.cache.set_members(&key);
+        self.record_cache_op("set_members", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
+    }
+
+    fn del_prefix(&mut self, prefix: String) -> Result<u64, String> {
+        let res = self.cache.del_prefix(&prefix);
+        self.record_cache_op("del_prefix", op_result(&res), 1);
+        res.map_err(|e| e.to_string())
     }
 }
 
@@ -264,6 +668,12 @@ impl JsonLogView {
         })))
     }
 
+    /// Re-encodes the parsed document. The original bytes are unescaped in
+    /// place while parsing, so this is the only faithful copy left.
+    pub fn to_vec(&self) -> Vec<u8> {
+        simd_json::to_vec(&self.0.doc).unwrap_or_default()
+    }
+
     pub fn lookup<'a>(&'a self, path: &str) -> Option<&'a BorrowedValue<'a>> {
         let mut v = &self.0.doc;
 
@@ -390,3 +800,194 @@ impl HasData for HostEngine {
 }
 
 impl log::Host for HostEngine {}
+
+#[cfg(test)]
+mod tests {
+    use std::io::Write;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::sync::Arc;
+
+    use axum::http::{HeaderMap, StatusCode};
+    use axum::response::{IntoResponse, Redirect};
+    use axum::routing::get;
+    use axum::{serve, Router as AxumRouter};
+    use reqwest::Client;
+    use tokio::net::TcpListener;
+
+    use super::{
+        gunzip_body, remote, remote_client, response_limit, HostAllowlist, HostEngine,
+        MAX_RESPONSE_BYTES_HEADER, TRUNCATED_HEADER,
+    };
+
+    async fn serve_app(app: AxumRouter) -> std::net::SocketAddr {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let addr = listener.local_addr().unwrap();
+        tokio::spawn(async move { serve(listener, app).await });
+        addr
+    }
+
+    fn get_request(url: String, headers: &[(&str, &str)]) -> remote::Request {
+        remote::Request {
+            id: "r1".into(),
+            method: remote::Method::Get,
+            url,
+            headers: headers
+                .iter()
+                .map(|(k, v)| (k.to_string(), v.to_string()))
+                .collect(),
+            body: Vec::new(),
+            timeout_ms: None,
+            cache_ttl_ms: None,
+        }
+    }
+
+    #[test]
+    fn allowlist_matches_connect_host() {
+        let allow = HostAllowlist::new(&["ipinfo.io".into(), "*.slack.com".into()]);
+
+        assert!(allow.check("https://ipinfo.io/8.8.8.8").is_ok());
+        assert!(allow.check("https://IPINFO.io./8.8.8.8").is_ok());
+        assert!(allow.check("https://api.slack.com/chat").is_ok());
+        assert!(allow.check("https://slack.com/").is_err());
+        assert!(allow.check("https://evilslack.com/").is_err());
+        assert!(allow.check("https://ipinfo.io@evil.com/").is_err());
+        assert!(allow.check("https://ipinfo.io.evil.com/").is_err());
+        assert!(allow.check("http://127.0.0.1:8080/").is_err());
+        assert!(allow.check("http://[::1]/").is_err());
+        assert!(allow.check("not a url").is_err());
+    }
+
+    #[test]
+    fn gunzip_round_trips() {
+        let payload = br#"{"country":"US","ip":"8.8.8.8"}"#.repeat(64);
+        let mut enc = flate2::write::GzEncoder::new(Vec::new(), flate2::Compression::default());
+        enc.write_all(&payload).unwrap();
+        let gz = enc.finish().unwrap();
+
+        assert!(gz.len() < payload.len());
+        assert_eq!(
+            gunzip_body(&gz, u64::MAX).unwrap(),
+            (payload.clone(), false)
+        );
+        assert!(gunzip_body(b"not gzip", u64::MAX).is_err());
+
+        let (capped, truncated) = gunzip_body(&gz, 100).unwrap();
+        assert!(truncated);
+        assert_eq!(capped, payload[..100]);
+    }
+
+    #[test]
+    fn response_limit_defaults_and_unlimited() {
+        assert_eq!(response_limit(0, 1024), 1024);
+        assert_eq!(response_limit(10, 1024), 10);
+        assert_eq!(response_limit(1 << 30, 1024), 1 << 30);
+        assert_eq!(response_limit(-1, 1024), u64::MAX);
+    }
+
+    #[tokio::test]
+    async fn oversized_responses_are_cut_and_marked() {
+        // The limit header is the host's to consume; upstream never sees it.
+        let app = AxumRouter::new().route(
+            "/big",
+            get(|headers: HeaderMap| async move {
+                if headers.contains_key(MAX_RESPONSE_BYTES_HEADER) {
+                    return StatusCode::BAD_REQUEST.into_response();
+                }
+                vec![b'x'; 1000].into_response()
+            }),
+        );
+        let url = format!("http://{}/big", serve_app(app).await);
+        let truncated = |r: &remote::Response| {
+            r.headers
+                .iter()
+                .any(|(k, v)| k == TRUNCATED_HEADER && v == "true")
+        };
+
+        let resp =
+            HostEngine::execute_single(Client::new(), get_request(url.clone(), &[]), 100).await;
+        assert_eq!(resp.status, 200);
+        assert_eq!(resp.body.len(), 100);
+        assert!(truncated(&resp));
+
+        let resp = HostEngine::execute_single(
+            Client::new(),
+            get_request(url.clone(), &[(MAX_RESPONSE_BYTES_HEADER, "-1")]),
+            100,
+        )
+        .await;
+        assert_eq!(resp.status, 200);
+        assert_eq!(resp.body.len(), 1000);
+        assert!(!truncated(&resp));
+
+        let resp = HostEngine::execute_single(
+            Client::new(),
+            get_request(url.clone(), &[(MAX_RESPONSE_BYTES_HEADER, "10")]),
+            100,
+        )
+        .await;
+        assert_eq!(resp.body.len(), 10);
+        assert!(truncated(&resp));
+
+        let resp = HostEngine::execute_single(
+            Client::new(),
+            get_request(url, &[(MAX_RESPONSE_BYTES_HEADER, "lots")]),
+            100,
+        )
+        .await;
+        assert_eq!(resp.status, 0);
+        assert!(resp
+            .error
+            .unwrap()
+            .starts_with("invalid x-tangent-max-response-bytes"));
+    }
+
+    #[tokio::test]
+    async fn allowlist_applies_to_every_redirect_hop() {
+        let outside_hits = Arc::new(AtomicUsize::new(0));
+        let hits = outside_hits.clone();
+        let outside = serve_app(AxumRouter::new().route(
+            "/",
+            get(move || {
+                hits.fetch_add(1, Ordering::SeqCst);
+                async { "exfiltrated" }
+            }),
+        ))
+        .await;
+
+        let away = format!("http://localhost:{}/", outside.port());
+        let allowed = serve_app(
+            AxumRouter::new()
+                .route(
+                    "/away",
+                    get(move || {
+                        let redirect = Redirect::temporary(&away);
+                        async { redirect }
+                    }),
+                )
+                .route("/here", get(|| async { Redirect::temporary("/ok") }))
+                .route("/ok", get(|| async { "ok" })),
+        )
+        .await;
+
+        let client = remote_client(Some(Arc::new(HostAllowlist::new(&["127.0.0.1".into()]))));
+
+        let resp = HostEngine::execute_single(
+            client.clone(),
+            get_request(format!("http://{allowed}/away"), &[]),
+            1024,
+        )
+        .await;
+        assert_eq!(resp.status, 0);
+        assert_eq!(resp.error.as_deref(), Some("host not allowed: localhost"));
+        assert_eq!(outside_hits.load(Ordering::SeqCst), 0);
+
+        let resp = HostEngine::execute_single(
+            client,
+            get_request(format!("http://{allowed}/here"), &[]),
+            1024,
+        )
+        .await;
+        assert_eq!(resp.status, 200);
+        assert_eq!(resp.body, b"ok");
+    }
+}
@@ -1,5 +1,6 @@
 use std::sync::Arc;
 
+use anyhow::Context;
 use wasmtime::component::Component;
 use wasmtime::Store;
 
@@ -38,10 +39,7 @@ impl Mappers {
             let meta = guest.call_metadata(&mut store).await?;
             let sels: Vec<Selector> = guest.call_probe(&mut store).await?;
 
-            let selectors: Vec<CompiledSelector> = sels
-                .iter()
-                .map(compile_selector)
-                .collect::<anyhow::Result<_>>()?;
+            let selectors = compile_selectors(name, &meta.name, &meta.version, &sels)?;
 
             mappers.push(MapperCtx {
                 cfg_name: Arc::clone(name),
@@ -56,3 +54,81 @@ impl Mappers {
         Ok(Self { mappers })
     }
 }
+
+/// Compiles a plugin's probe selectors, rejecting an empty list (the plugin
+/// would never receive logs) and naming the selector that fails to compile.
+fn compile_selectors(
+    name: &str,
+    module: &str,
+    version: &str,
+    sels: &[Selector],
+) -> anyhow::Result<Vec<CompiledSelector>> {
+    if sels.is_empty() {
+        anyhow::bail!(
+            "plugin {name} ({module}@{version}) returned no selectors and would never receive logs"
+        );
+    }
+
+    sels.iter()
+        .enumerate()
+        .map(|(i, sel)| {
+            compile_selector(sel).with_context(|| {
+                format!("compiling selector {i} for plugin {name} ({module}@{version})")
+            })
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::wasm::host::exports::tangent::logs::mapper::Pred;
+
+    fn selector(all: Vec<Pred>) -> Selector {
+        Selector {
+            any: vec![],
+            all,
+            none: vec![],
+        }
+    }
+
+    #[test]
+    fn compile_selectors_cases() {
+        let has = || Pred::Has("ts".to_string());
+        let bad_re = || Pred::Regex(("msg".to_string(), "(unclosed".to_string()));
+
+        let cases: Vec<(&str, Vec<Selector>, Result<usize, &str>)> = vec![
+            ("one selector", vec![selector(vec![has()])], Ok(1)),
+            (
+                "several selectors",
+                vec![selector(vec![has()]), selector(vec![])],
+                Ok(2),
+            ),
+            (
+                "no selectors",
+                vec![],
+                Err("plugin p (zeek@0.1.0) returned no selectors and would never receive logs"),
+            ),
+            (
+                "bad regex in first selector",
+                vec![selector(vec![bad_re()])],
+                Err("compiling selector 0 for plugin p (zeek@0.1.0)"),
+            ),
+            (
+                "bad regex in a later selector",
+                vec![selector(vec![has()]), selector(vec![has(), bad_re()])],
+                Err("compiling selector 1 for plugin p (zeek@0.1.0)"),
+            ),
+        ];
+
+        for (desc, sels, want) in cases {
+            let got = compile_selectors("p", "zeek", "0.1.0", &sels);
+            match (got, want) {
+                (Ok(compiled), Ok(n)) => assert_eq!(compiled.len(), n, "{desc}"),
+                (Err(e), Err(msg)) => assert_eq!(e.to_string(), msg, "{desc}"),
+                (Ok(_), Err(msg)) => panic!("{desc}: expected error {msg:?}"),
+                (Err(e), Ok(_)) => panic!("{desc}: unexpected error {e:#}"),
+            }
+        }
+    }
+}
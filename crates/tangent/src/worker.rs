@@ -1,7 +1,9 @@
-use ahash::{HashMap, HashMapExt};
+use ahash::HashMap;
 use anyhow::Result;
 use async_trait::async_trait;
 use bytes::{Bytes, BytesMut};
+use sha2::{Digest, Sha256};
+use std::collections::BTreeMap;
 use std::sync::{
     atomic::{AtomicUsize, Ordering},
     Arc,
@@ -16,10 +18,14 @@ use wasmtime::component::{Component, Resource};
 
 use crate::wasm::host::JsonLogView;
 use crate::{
-    router::Router,
+    router::{RefCountAck, Router},
     wasm::{self, mapper::Mappers, probe::eval_selector},
 };
-use crate::{CONSUMER_BYTES_TOTAL, CONSUMER_OBJECTS_TOTAL, GUEST_BYTES_TOTAL, GUEST_LATENCY};
+use crate::{
+    CONSUMER_BYTES_TOTAL, CONSUMER_OBJECTS_TOTAL, GUEST_BYTES_TOTAL, GUEST_LATENCY,
+    MALFORMED_LOGS_TOTAL, PLUGIN_BATCH_SECONDS_PER_LOG, PLUGIN_LATENCY, PLUGIN_LOGS_TOTAL,
+    UNMATCHED_LOGS_TOTAL,
+};
 
 #[async_trait]
 pub trait Ack: Send + Sync {
@@ -37,6 +43,8 @@ pub struct Worker {
     mappers: Mappers,
     batch_max_size: usize,
     batch_max_age: Duration,
+    fail_batch_on_malformed: bool,
+    plugin_timing: bool,
     router: Arc<Router>,
 }
 
@@ -112,30 +120,30 @@ impl Worker {
             return Ok(());
         }
 
-        let mut groups: HashMap<usize, Vec<JsonLogView>> = HashMap::default();
-        let mut sizes: HashMap<usize, usize> = HashMap::default();
-        for b in batch.drain(..) {
-            let sz = b.len();
-            let lv = JsonLogView::from_bytes(b)?;
-            let mut matched = false;
-            for (idx, m) in self.mappers.mappers.iter_mut().enumerate() {
-                if m.selectors.iter().any(|s| eval_selector(s, &lv)) {
-                    groups.entry(idx).or_default().push(lv.clone());
-                    *sizes.entry(idx).or_default() += sz;
-                    matched = true;
-                }
-            }
-
-            if !matched {
-                tracing::debug!("log did not match any mappers");
-            }
-        }
+        let mappers = &self.mappers.mappers;
+        let (groups, sizes) = group_by_mapper(
+            self.id,
+            batch.drain(..),
+            |idx, lv| mappers[idx].selectors.iter().any(|s| eval_selector(s, lv)),
+            mappers.len(),
+            self.fail_batch_on_malformed,
+        );
 
-        let mut plugin_outputs: HashMap<Arc<str>, Vec<BytesMut>> =
-            HashMap::with_capacity(batch.len());
+        let mut plugin_outputs: Vec<(Arc<str>, Option<Arc<str>>, Vec<BytesMut>)> = Vec::new();
+        let mut dead_letters: Vec<(Arc<str>, String, Vec<Vec<u8>>)> = Vec::new();
+        let mut timing = BatchTiming::default();
 
         for (idx, lvs) in groups {
             let m = &mut self.mappers.mappers[idx];
+            let dead = self
+                .router
+                .has_dead_letter(&m.cfg_name)
+                .then(|| lvs.clone());
+            let batch = self
+                .router
+                .wants_batch_id(&m.cfg_name)
+                .then(|| batch_id(&m.name, &m.version, lvs.iter().map(JsonLogView::to_vec)));
+            let matched = lvs.len() as u64;
 
             let mut owned: Vec<Resource<JsonLogView>> = Vec::new();
             for lv in lvs {
@@ -155,6 +163,12 @@ impl Worker {
                 .with_label_values(&[&self.id.to_string()])
                 .observe(secs);
             GUEST_BYTES_TOTAL.inc_by(*sizes.get(&idx).unwrap() as u64);
+            if self.plugin_timing {
+                timing.record(&m.cfg_name, secs, matched);
+            }
+            PLUGIN_LOGS_TOTAL
+                .with_label_values(&[&*m.cfg_name, "matched"])
+                .inc_by(matched);
 
             let out = match res {
                 Err(host_err) => {
@@ -164,6 +178,13 @@ impl Worker {
                 Ok(Ok(frames)) => frames,
                 Ok(Err(guest_err)) => {
                     tracing::warn!(mapper=%m.name, error = ?guest_err, "guest error; skipping");
+                    PLUGIN_LOGS_TOTAL
+                        .with_label_values(&[&*m.cfg_name, "errored"])
+                        .inc_by(matched);
+                    if let Some(lvs) = dead {
+                        let raws: Vec<Vec<u8>> = lvs.iter().map(JsonLogView::to_vec).collect();
+                        dead_letters.push((m.cfg_name.clone(), guest_err, raws));
+                    }
                     continue;
                 }
             };
@@ -173,23 +194,43 @@ impl Worker {
                 continue;
             }
 
-            plugin_outputs
-                .entry(m.cfg_name.clone())
-                .or_default()
-                .push(Bytes::from(out).try_into_mut().unwrap())
+            PLUGIN_LOGS_TOTAL
+                .with_label_values(&[&*m.cfg_name, "emitted"])
+                .inc_by(out.split(|b| *b == b'\n').filter(|l| !l.is_empty()).count() as u64);
+
+            let frame = Bytes::from(out).try_into_mut().unwrap();
+            add_output(&mut plugin_outputs, &m.cfg_name, batch, frame);
         }
 
+        timing.publish();
+
         let upstream_acks = std::mem::take(acks);
-        let mut remaining = upstream_acks;
-
-        for (plugin_name, frames) in plugin_outputs {
-            self.router
-                .forward(
-                    &NodeRef::Plugin { name: plugin_name },
-                    frames,
-                    std::mem::take(&mut remaining),
-                )
-                .await?;
+        let deliveries = plugin_outputs.len() + dead_letters.len();
+        if deliveries == 0 {
+            // Nothing to deliver (no matches, or only malformed logs): the
+            // input is fully handled.
+            for a in upstream_acks {
+                let _ = a.ack().await;
+            }
+        } else {
+            // The input is only handled once every output and every
+            // dead-lettered batch has been written.
+            let shared: Arc<dyn Ack> = Arc::new(RefCountAck::new(upstream_acks, deliveries));
+            for (plugin_name, batch, frames) in plugin_outputs {
+                self.router
+                    .forward_batch(
+                        &NodeRef::Plugin { name: plugin_name },
+                        frames,
+                        batch,
+                        vec![shared.clone()],
+                    )
+                    .await?;
+            }
+            for (plugin, error, raws) in dead_letters {
+                self.router
+                    .dead_letter(&plugin, &error, &raws, vec![shared.clone()])
+                    .await?;
+            }
         }
 
         batch.clear();
@@ -198,6 +239,123 @@ impl Worker {
     }
 }
 
+/// Groups a batch under every mapper whose selectors match each log, and
+/// sums the input bytes per group. Groups are keyed by mapper index so
+/// plugins run, and their outputs are forwarded, in config order on every
+/// batch. Malformed logs are skipped, or with `fail_on_malformed` empty the
+/// whole batch.
+fn group_by_mapper(
+    worker: usize,
+    batch: impl Iterator<Item = BytesMut>,
+    matches: impl Fn(usize, &JsonLogView) -> bool,
+    mappers: usize,
+    fail_on_malformed: bool,
+) -> (BTreeMap<usize, Vec<JsonLogView>>, HashMap<usize, usize>) {
+    let mut groups: BTreeMap<usize, Vec<JsonLogView>> = BTreeMap::new();
+    let mut sizes: HashMap<usize, usize> = HashMap::default();
+    for b in batch {
+        let sz = b.len();
+        // Unless configured otherwise, one malformed log must not cost the
+        // rest of the batch.
+        let lv = match JsonLogView::from_bytes(b) {
+            Ok(lv) => lv,
+            Err(e) if fail_on_malformed => {
+                MALFORMED_LOGS_TOTAL.inc();
+                tracing::warn!(worker, bytes = sz, error = %e, "dropping batch with malformed log");
+                return (BTreeMap::new(), HashMap::default());
+            }
+            Err(e) => {
+                MALFORMED_LOGS_TOTAL.inc();
+                tracing::warn!(worker, bytes = sz, error = %e, "skipping malformed log");
+                continue;
+            }
+        };
+        let mut matched = false;
+        for idx in (0..mappers).filter(|idx| matches(*idx, &lv)) {
+            groups.entry(idx).or_default().push(lv.clone());
+            *sizes.entry(idx).or_default() += sz;
+            matched = true;
+        }
+
+        if !matched {
+            UNMATCHED_LOGS_TOTAL.inc();
+            tracing::debug!("log did not match any mappers");
+        }
+    }
+    (groups, sizes)
+}
+
+/// Plugin timings for one batch. A process-logs call covers all of a
+/// plugin's logs at once, so the finest grain is a call's time divided by
+/// its logs; each plugin keeps its slowest call's.
+#[derive(Default)]
+struct BatchTiming {
+    per_log: Vec<(Arc<str>, f64)>,
+}
+
+impl BatchTiming {
+    /// Attributes one process-logs call over `logs` logs to its plugin.
+    fn record(&mut self, plugin: &Arc<str>, secs: f64, logs: u64) {
+        PLUGIN_LATENCY.with_label_values(&[&**plugin]).observe(secs);
+        if logs == 0 {
+            return;
+        }
+        let per_log = secs / logs as f64;
+        match self.per_log.iter_mut().find(|(p, _)| p == plugin) {
+            Some((_, max)) => *max = max.max(per_log),
+            None => self.per_log.push((plugin.clone(), per_log)),
+        }
+    }
+
+    /// Replaces each timed plugin's gauge with this batch's value.
+    fn publish(self) {
+        for (plugin, per_log) in self.per_log {
+            PLUGIN_BATCH_SECONDS_PER_LOG
+                .with_label_values(&[&*plugin])
+                .set(per_log);
+        }
+    }
+}
+
+/// Adds a mapper's output under its plugin. Plugins keep first-seen order and
+/// each plugin's frames keep mapper order.
+fn add_output(
+    outputs: &mut Vec<(Arc<str>, Option<Arc<str>>, Vec<BytesMut>)>,
+    plugin: &Arc<str>,
+    batch: Option<Arc<str>>,
+    frame: BytesMut,
+) {
+    match outputs
+        .iter_mut()
+        .find(|(name, id, _)| name == plugin && *id == batch)
+    {
+        Some((_, _, frames)) => frames.push(frame),
+        None => outputs.push((plugin.clone(), batch, vec![frame])),
+    }
+}
+
+/// Fingerprint of a plugin input batch: the first 128 bits of
+/// sha256(module@version, logs), hex encoded. Replaying the same input
+/// through the same build of a plugin gives the same id, so objects keyed by
+/// it overwrite rather than duplicate and downstream can dedup on it.
+pub(crate) fn batch_id<L: AsRef<[u8]>>(
+    module: &str,
+    version: &str,
+    logs: impl IntoIterator<Item = L>,
+) -> Arc<str> {
+    let mut hasher = Sha256::new();
+    hasher.update(module.as_bytes());
+    hasher.update(b"@");
+    hasher.update(version.as_bytes());
+    hasher.update([0u8]);
+    for log in logs {
+        let log = log.as_ref();
+        hasher.update((log.len() as u64).to_le_bytes());
+        hasher.update(log);
+    }
+    Arc::from(hex::encode(&hasher.finalize()[..16]))
+}
+
 pub struct WorkerPool {
     senders: Vec<mpsc::Sender<Record>>,
     rr: AtomicUsize,
@@ -211,6 +369,8 @@ impl WorkerPool {
         components: Vec<Vec<(Arc<str>, Component)>>,
         batch_max_size: usize,
         batch_max_age: Duration,
+        fail_batch_on_malformed: bool,
+        plugin_timing: bool,
         router: Arc<Router>,
     ) -> anyhow::Result<Self> {
         let mut senders = Vec::with_capacity(size);
@@ -249,6 +409,8 @@ impl WorkerPool {
                 mappers,
                 batch_max_size,
                 batch_max_age,
+                fail_batch_on_malformed,
+                plugin_timing,
                 router: Arc::clone(&router),
             };
             let h = tokio::spawn(async move {
@@ -319,3 +481,98 @@ impl WorkerPool {
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn groups_and_outputs_keep_config_order() {
+        let batch = [
+            r#"{"path":"dns","i":0}"#,
+            r#"{"path":"conn","i":1}"#,
+            "not json",
+            r#"{"path":"dns","i":3}"#,
+            r#"{"path":"conn","i":4}"#,
+        ];
+        // Mapper 0 takes conn, mapper 1 dns, mapper 2 everything; 0 and 2
+        // belong to the same plugin.
+        let paths = ["conn", "dns", ""];
+        let plugins: [Arc<str>; 3] = [Arc::from("zeek"), Arc::from("dns"), Arc::from("zeek")];
+        let matches = |idx: usize, lv: &JsonLogView| {
+            String::from_utf8(lv.to_vec()).unwrap().contains(paths[idx])
+        };
+
+        let mut first: Option<Vec<(Arc<str>, Option<Arc<str>>, Vec<BytesMut>)>> = None;
+        for _ in 0..32 {
+            let logs = batch.iter().map(|l| BytesMut::from(*l));
+            let (groups, sizes) = group_by_mapper(0, logs, matches, paths.len(), false);
+            assert_eq!(groups.keys().copied().collect::<Vec<_>>(), [0, 1, 2]);
+            assert_eq!(groups[&2].len(), 4);
+            assert_eq!(sizes[&0], batch[1].len() + batch[4].len());
+
+            let mut outputs = Vec::new();
+            for (idx, lvs) in &groups {
+                let mut frame = BytesMut::new();
+                for lv in lvs {
+                    frame.extend_from_slice(&lv.to_vec());
+                    frame.extend_from_slice(b"\n");
+                }
+                add_output(&mut outputs, &plugins[*idx], None, frame);
+            }
+            let names: Vec<&str> = outputs.iter().map(|(n, _, _)| &**n).collect();
+            assert_eq!(names, ["zeek", "dns"]);
+            assert_eq!(outputs[0].2.len(), 2);
+
+            match &first {
+                Some(prev) => assert_eq!(&outputs, prev),
+                None => first = Some(outputs),
+            }
+        }
+    }
+
+    #[test]
+    fn malformed_logs_skip_the_log_or_fail_the_batch() {
+        let batch = [r#"{"i":0}"#, "{\"i\":", r#"{"i":2}"#];
+        let logs = || batch.iter().map(|l| BytesMut::from(*l));
+        let all = |_: usize, _: &JsonLogView| true;
+
+        let (groups, sizes) = group_by_mapper(0, logs(), all, 1, false);
+        let kept: Vec<Vec<u8>> = groups[&0].iter().map(JsonLogView::to_vec).collect();
+        assert_eq!(kept, [br#"{"i":0}"#.to_vec(), br#"{"i":2}"#.to_vec()]);
+        assert_eq!(sizes[&0], batch[0].len() + batch[2].len());
+
+        let (groups, sizes) = group_by_mapper(0, logs(), all, 1, true);
+        assert!(groups.is_empty());
+        assert!(sizes.is_empty());
+    }
+
+    #[test]
+    fn plugin_time_is_attributed_to_the_slow_plugin() {
+        let fast: Arc<str> = Arc::from("timing_fast");
+        let slow: Arc<str> = Arc::from("timing_slow");
+
+        let mut timing = BatchTiming::default();
+        timing.record(&fast, 0.002, 10);
+        timing.record(&slow, 0.5, 10);
+        timing.record(&slow, 0.01, 10);
+        timing.record(&slow, 0.0, 0);
+        timing.publish();
+
+        let calls = |p: &str| PLUGIN_LATENCY.with_label_values(&[p]).get_sample_count();
+        let total = |p: &str| PLUGIN_LATENCY.with_label_values(&[p]).get_sample_sum();
+        let per_log = |p: &str| PLUGIN_BATCH_SECONDS_PER_LOG.with_label_values(&[p]).get();
+
+        assert_eq!((calls("timing_fast"), calls("timing_slow")), (1, 3));
+        assert!((total("timing_slow") - 0.51).abs() < 1e-9);
+        assert!((per_log("timing_slow") - 0.05).abs() < 1e-9);
+        assert!((per_log("timing_fast") - 0.0002).abs() < 1e-9);
+
+        // The next batch replaces the values rather than keeping a max.
+        let mut timing = BatchTiming::default();
+        timing.record(&slow, 0.01, 10);
+        timing.publish();
+        assert!((per_log("timing_slow") - 0.001).abs() < 1e-9);
+        assert!((per_log("timing_fast") - 0.0002).abs() < 1e-9);
+    }
+}
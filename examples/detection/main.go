@@ -20,6 +20,9 @@ var Metadata = tangent_sdk.Metadata{
 	Version: "0.1.0",
 }
 
+// Set in init, which refuses to register the plugin without it.
+var slackAccessToken string
+
 var selectors = []tangent_sdk.Selector{
 	{
 		All: []tangent_sdk.Predicate{
@@ -39,11 +42,6 @@ func ExampleAlert(lv tangent_sdk.Log) (Alert, error) {
 	}
 
 	if ok && seen.(bool) {
-		accessToken := os.Getenv("SLACK_ACCESS_TOKEN")
-		if accessToken == "" {
-			return Alert{}, fmt.Errorf("SLACK_ACCESS_TOKEN not set")
-		}
-
 		type slackPayload struct {
 			Text    string `json:"text"`
 			Channel string `json:"channel"`
@@ -68,7 +66,7 @@ func ExampleAlert(lv tangent_sdk.Log) (Alert, error) {
 				},
 				{
 					Name:  "Authorization",
-					Value: "Bearer " + accessToken,
+					Value: "Bearer " + slackAccessToken,
 				},
 			},
 		})
@@ -101,6 +99,13 @@ func ExampleAlert(lv tangent_sdk.Log) (Alert, error) {
 }
 
 func init() {
+	// Fail instantiation rather than the first alert when the token is
+	// missing.
+	slackAccessToken = os.Getenv("SLACK_ACCESS_TOKEN")
+	if slackAccessToken == "" {
+		panic("detection: SLACK_ACCESS_TOKEN is not set")
+	}
+
 	tangent_sdk.Wire[Alert](
 		Metadata,
 		selectors,
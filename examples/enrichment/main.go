@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 
 	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
 	"github.com/telophasehq/tangent-sdk-go/http"
@@ -55,7 +56,8 @@ func ExampleMapper(lvs []tangent_sdk.Log) ([]EnrichedOutput, error) {
 
 	reqs := make([]http.Request, 0, len(ipToIdx))
 	for ip := range ipToIdx {
-		u := "https://ipinfo.io/" + url.QueryEscape(ip)
+		// ip is a path segment, not a query value, so path-escape it.
+		u := "https://ipinfo.io/" + url.PathEscape(ip)
 
 		reqs = append(reqs, http.Request{
 			ID:     ip,
@@ -75,18 +77,23 @@ func ExampleMapper(lvs []tangent_sdk.Log) ([]EnrichedOutput, error) {
 
 	ipToCountry := make(map[string]string, len(resps))
 
+	// A failed lookup only costs that IP its country; the rest of the batch
+	// still goes out. Only a batch-level error above is fatal.
 	for _, resp := range resps {
 		if resp.Error != nil && *resp.Error != "" {
-			return nil, fmt.Errorf("remote error for ip %s: %s", resp.ID, *resp.Error)
+			fmt.Fprintf(os.Stderr, "ipinfo lookup failed for %s: %s\n", resp.ID, *resp.Error)
+			continue
 		}
 
 		if resp.Status != 200 {
-			return nil, fmt.Errorf("remote returned status %d for ip %s", resp.Status, resp.ID)
+			fmt.Fprintf(os.Stderr, "ipinfo returned status %d for %s\n", resp.Status, resp.ID)
+			continue
 		}
 
 		var payload ipinfoPayload
 		if err := json.Unmarshal(resp.Body, &payload); err != nil {
-			return nil, fmt.Errorf("failed to decode ipinfo response for %s: %w", resp.ID, err)
+			fmt.Fprintf(os.Stderr, "failed to decode ipinfo response for %s: %v\n", resp.ID, err)
+			continue
 		}
 
 		ipToCountry[resp.ID] = payload.Country
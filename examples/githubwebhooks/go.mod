@@ -9,7 +9,7 @@ require (
 	go.bytecodealliance.org/cm v0.3.0 // indirect
 )
 
-require github.com/mailru/easyjson v0.9.1 // indirect
+require github.com/mailru/easyjson v0.9.1
 
 require (
 	github.com/coreos/go-semver v0.3.1 // indirect
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -50,44 +51,38 @@ func DetectNPMPublish(lv tangent_sdk.Log) (Alert, error) {
 	}
 
 	cacheTTL := 15 * time.Minute
-	startedKey := fmt.Sprintf("npm-publish-started-%s-logname", *sha)
-	pkgKey := fmt.Sprintf("npm-publish-started-%s-pkgname", *sha)
-	shasumKey := fmt.Sprintf("npm-publish-started-%s-npmSHA", *sha)
+	stateKey := fmt.Sprintf("npm-publish-started-%s", *sha)
 
 	// 1) Mark that this SHA started an npm publish step, and record which log file
 	if strings.Contains(m, "##[group]Run") && strings.Contains(m, "npm publish") {
-		if err := cache.Set(startedKey, *logName, &cacheTTL); err != nil {
-			return out, err
-		}
-		return out, nil
+		return out, setPublishState(stateKey, publishState{LogFile: *logName}, cacheTTL)
 	}
 
 	// Everything below requires that we previously saw a publish step for this SHA/log
-	startedLogNameVal, ok, err := cache.Get(startedKey)
+	state, ok, err := getPublishState(stateKey)
 	if err != nil {
 		return out, err
 	}
-	if !ok || startedLogNameVal.(string) != *logName {
+	if !ok || state.LogFile != *logName {
 		// Either no publish step yet, or this is a different log file
 		return out, nil
 	}
 
 	// 2) Capture package name from `npm notice name: foo`
 	if strings.HasPrefix(m, "npm notice name:") {
-		pkgName := strings.TrimSpace(strings.TrimPrefix(m, "npm notice name:"))
-		if err := cache.Set(pkgKey, pkgName, &cacheTTL); err != nil {
-			return out, err
-		}
-		return out, nil
+		state.Package = strings.TrimSpace(strings.TrimPrefix(m, "npm notice name:"))
+		return out, setPublishState(stateKey, state, cacheTTL)
 	}
 
 	// 3) Capture npm tarball shasum from `npm notice shasum: abc123...`
 	if strings.HasPrefix(m, "npm notice shasum:") {
-		npmSHA := strings.TrimSpace(strings.TrimPrefix(m, "npm notice shasum:"))
-		if err := cache.Set(shasumKey, npmSHA, &cacheTTL); err != nil {
-			return out, err
-		}
-		return out, nil
+		state.Shasum = strings.TrimSpace(strings.TrimPrefix(m, "npm notice shasum:"))
+		return out, setPublishState(stateKey, state, cacheTTL)
+	}
+
+	// Fresh evidence for this publish keeps the correlation window open.
+	if strings.HasPrefix(m, "npm notice") {
+		return out, setPublishState(stateKey, state, cacheTTL)
 	}
 
 	// 4) Success line: `+ package@version`
@@ -100,6 +95,12 @@ func DetectNPMPublish(lv tangent_sdk.Log) (Alert, error) {
 			return out, err
 		}
 
+		// The publish step is done; drop its state so a rerun of the
+		// same SHA starts from a clean slate instead of re-alerting.
+		if _, err := cache.Delete(stateKey); err != nil {
+			return out, err
+		}
+
 		out.Triggered = true
 		return out, nil
 	}
@@ -107,6 +108,39 @@ func DetectNPMPublish(lv tangent_sdk.Log) (Alert, error) {
 	return out, nil
 }
 
+// publishState is everything learned about one SHA's publish step, stored
+// under a single key so each log line costs one cache read and one write.
+type publishState struct {
+	LogFile string `json:"log_file"`
+	Package string `json:"package,omitempty"`
+	Shasum  string `json:"shasum,omitempty"`
+}
+
+func getPublishState(key string) (publishState, bool, error) {
+	var state publishState
+
+	v, ok, err := cache.Get(key)
+	if err != nil || !ok {
+		return state, false, err
+	}
+	raw, isBytes := v.([]byte)
+	if !isBytes {
+		return state, false, fmt.Errorf("cache key %q: expected publish state bytes, got %T", key, v)
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return state, false, fmt.Errorf("cache key %q: decoding publish state: %w", key, err)
+	}
+	return state, true, nil
+}
+
+func setPublishState(key string, state publishState, ttl time.Duration) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("cache key %q: encoding publish state: %w", key, err)
+	}
+	return cache.Set(key, raw, &ttl)
+}
+
 func init() {
 	tangent_sdk.Wire[Alert](
 		Metadata,
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"fmt"
-
 	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
 )
 
@@ -29,9 +27,6 @@ var selectors = []tangent_sdk.Selector{
 func Detect(lv tangent_sdk.Log) (Alert, error) {
 	var out Alert
 
-	sha := lv.GetString("npm.dist.shasum")
-	fmt.Println(*sha)
-
 	return out, nil
 }
 
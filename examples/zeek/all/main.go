@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+
+	"zeek/mappers"
+
+	"github.com/mailru/easyjson"
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type AuthenticationAlias v1_5_0.Authentication
+type DHCPActivityAlias v1_5_0.DHCPActivity
+type DNSActivityAlias v1_5_0.DNSActivity
+type DetectionFindingAlias v1_5_0.DetectionFinding
+type EmailActivityAlias v1_5_0.EmailActivity
+type NetworkActivityAlias v1_5_0.NetworkActivity
+type NetworkFileActivityAlias v1_5_0.NetworkFileActivity
+type RDPActivityAlias v1_5_0.RDPActivity
+type SMBActivityAlias v1_5_0.SMBActivity
+type SSHActivityAlias v1_5_0.SSHActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek → ocsf (all logs)",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("ts"),
+			tangent_sdk.Has("_path"),
+		},
+	},
+}
+
+var errNotMarshaler = errors.New("output does not implement easyjson.Marshaler. Did you recompile?")
+
+// Event is one output line: the OCSF event for a known _path, or the input
+// record unchanged for any other.
+type Event struct {
+	out any
+	raw string
+}
+
+func (e *Event) MarshalEasyJSON(w *jwriter.Writer) {
+	if e.out == nil {
+		w.RawString(e.raw)
+		return
+	}
+	m, ok := e.out.(easyjson.Marshaler)
+	if !ok {
+		w.Error = errNotMarshaler
+		return
+	}
+	m.MarshalEasyJSON(w)
+}
+
+type handler func(tangent_sdk.Log) (any, error)
+
+// handlers maps each Zeek _path to its mapper, converted to this plugin's
+// alias types so they pick up the generated encoders.
+var handlers = map[string]handler{
+	"conn": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.ZeekMapper(lv)
+		return (*NetworkActivityAlias)(out), err
+	},
+	"dhcp": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekDHCP(lv)
+		return (*DHCPActivityAlias)(out), err
+	},
+	"dns": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekDNS(lv)
+		return (*DNSActivityAlias)(out), err
+	},
+	"files": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekFiles(lv)
+		return (*NetworkFileActivityAlias)(out), err
+	},
+	"kerberos": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekKerberos(lv)
+		return (*AuthenticationAlias)(out), err
+	},
+	"notice": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekNotice(lv)
+		return (*DetectionFindingAlias)(out), err
+	},
+	"ntp": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekNTP(lv)
+		return (*NetworkActivityAlias)(out), err
+	},
+	"rdp": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekRDP(lv)
+		return (*RDPActivityAlias)(out), err
+	},
+	"smb_files": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekSMBFiles(lv)
+		return (*SMBActivityAlias)(out), err
+	},
+	"smtp": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekSMTP(lv)
+		return (*EmailActivityAlias)(out), err
+	},
+	"ssh": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekSSH(lv)
+		return (*SSHActivityAlias)(out), err
+	},
+	"ssl": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekSSL(lv)
+		return (*NetworkActivityAlias)(out), err
+	},
+	"tunnel": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekTunnel(lv)
+		return (*NetworkActivityAlias)(out), err
+	},
+	"weird": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekWeird(lv)
+		return (*DetectionFindingAlias)(out), err
+	},
+	"x509": func(lv tangent_sdk.Log) (any, error) {
+		out, err := mappers.MapZeekX509(lv)
+		return (*NetworkActivityAlias)(out), err
+	},
+}
+
+// Dispatch maps a record with the handler for its _path. Records from log
+// types without a mapper pass through as-is instead of failing the batch;
+// they have no metadata.log_name, so a templated sink prefix files them
+// under its unknown partition.
+func Dispatch(lv tangent_sdk.Log) (*Event, error) {
+	var h handler
+	if path := lv.GetString("_path"); path != nil {
+		h = handlers[*path]
+	}
+	if h == nil {
+		return &Event{raw: lv.Log()}, nil
+	}
+	out, err := h(lv)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{out: out}, nil
+}
+
+func init() {
+	tangent_sdk.Wire(
+		metadata,
+		selectors,
+		Dispatch,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type DHCPActivityAlias v1_5_0.DHCPActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-dhcp → ocsf.dhcp_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("msg_types"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "dhcp"),
+		},
+	},
+}
+
+func MapZeekDHCP(lv tangent_sdk.Log) (*DHCPActivityAlias, error) {
+	out, err := mappers.MapZeekDHCP(lv)
+	return (*DHCPActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*DHCPActivityAlias](
+		metadata,
+		selectors,
+		MapZeekDHCP,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type DNSActivityAlias v1_5_0.DNSActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-dns → ocsf.dns_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("uid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "dns"),
+		},
+	},
+}
+
+func MapZeekDNS(lv tangent_sdk.Log) (*DNSActivityAlias, error) {
+	out, err := mappers.MapZeekDNS(lv)
+	return (*DNSActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*DNSActivityAlias](
+		metadata,
+		selectors,
+		MapZeekDNS,
+		nil,
+	)
+}
+func main() {}
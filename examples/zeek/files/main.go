@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type NetworkFileActivityAlias v1_5_0.NetworkFileActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-files → ocsf.network_file_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("fuid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "files"),
+		},
+	},
+}
+
+func MapZeekFiles(lv tangent_sdk.Log) (*NetworkFileActivityAlias, error) {
+	out, err := mappers.MapZeekFiles(lv)
+	return (*NetworkFileActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*NetworkFileActivityAlias](
+		metadata,
+		selectors,
+		MapZeekFiles,
+		nil,
+	)
+}
+func main() {}
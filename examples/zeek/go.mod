@@ -5,6 +5,7 @@ go 1.24.0
 toolchain go1.24.7
 
 require (
+	github.com/mailru/easyjson v0.9.1
 	github.com/telophasehq/go-ocsf v0.2.1
 	github.com/telophasehq/tangent-sdk-go v0.0.0-20251125161341-27ee39c60b57
 )
@@ -18,7 +19,6 @@ require (
 	github.com/google/go-cmp v0.7.0 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
-	github.com/mailru/easyjson v0.9.1 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
 	github.com/regclient/regclient v0.8.3 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type AuthenticationAlias v1_5_0.Authentication
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-kerberos → ocsf.authentication",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("uid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "kerberos"),
+		},
+	},
+}
+
+func MapZeekKerberos(lv tangent_sdk.Log) (*AuthenticationAlias, error) {
+	out, err := mappers.MapZeekKerberos(lv)
+	return (*AuthenticationAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*AuthenticationAlias](
+		metadata,
+		selectors,
+		MapZeekKerberos,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,353 @@
+package mappers
+
+import (
+	"math"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SPCap struct {
+	URL     *string `json:"url,omitempty"`
+	Rule    *int64  `json:"rule,omitempty"`
+	Trigger *string `json:"trigger,omitempty"`
+}
+
+type ICMP struct {
+	Type *int64 `json:"type,omitempty"`
+	Code *int64 `json:"code,omitempty"`
+}
+
+type OCSFUnMapped struct {
+	MissedBytes      *int64   `json:"missed_bytes,omitempty"`
+	VLAN             *int64   `json:"vlan,omitempty"`
+	App              []string `json:"app,omitempty"`
+	TunnelParent     []string `json:"tunnel_parents,omitempty"`
+	SuriIDs          []string `json:"suri_ids,omitempty"`
+	LocalOrig        *bool    `json:"local_orig,omitempty"`
+	LocalResp        *bool    `json:"local_resp,omitempty"`
+	OrigIPBytes      *int64   `json:"orig_ip_bytes,omitempty"`
+	RespIPBytes      *int64   `json:"resp_ip_bytes,omitempty"`
+	Pcr              *float64 `json:"pcr,omitempty"`
+	CorelightShunted *bool    `json:"corelight_shunted,omitempty"`
+	SPCap            *SPCap   `json:"spcap,omitempty"`
+	ICMP             *ICMP    `json:"icmp,omitempty"`
+}
+
+// ZeekMapper maps conn.log with the default severity scoring.
+var ZeekMapper = NewZeekMapper()
+
+func (m *connMapper) mapConn(lv tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4001 // network_activity
+	const categoryUID int32 = 4 // Network Activity
+	var activityID int32 = zeekocsf.ActivityTraffic
+	severityID := m.severity(lv)
+
+	// conn_state stays in status_code as Zeek logged it; the table turns it
+	// into an activity and an outcome.
+	statusCode := lv.GetString("conn_state")
+	var status, statusDetail *string
+	var statusID *int32
+	if statusCode != nil {
+		if cs, ok := zeekocsf.ConnStates[*statusCode]; ok {
+			activityID = cs.ActivityID
+			s, d, id := zeekocsf.StatusName(cs.StatusID), cs.Detail, cs.StatusID
+			status, statusDetail, statusID = &s, &d, &id
+		}
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	localOrig := lv.GetBool("local_orig")
+	localResp := lv.GetBool("local_resp")
+
+	var directionID *int32
+	switch {
+	case localOrig != nil && *localOrig && localResp != nil && !*localResp:
+		out := int32(2) // outbound
+		directionID = &out
+	case localOrig != nil && !*localOrig && localResp != nil && *localResp:
+		in := int32(1) // inbound
+		directionID = &in
+	}
+
+	var duration *int64
+	if d := lv.GetFloat64("duration"); d != nil {
+		ms := int64(math.Round(*d))
+		duration = &ms
+	}
+
+	var startTime, endTime int64
+	if duration != nil {
+		startTime = timeMs
+		endTime = timeMs + *duration
+	}
+
+	src, dst := zeekocsf.Endpoints(lv)
+	if src != nil {
+		if srcMac := lv.GetString("orig_l2_addr"); srcMac != nil {
+			src.Mac = srcMac
+		}
+	}
+
+	if dst != nil {
+		if dstMac := lv.GetString("resp_l2_addr"); dstMac != nil {
+			dst.Mac = dstMac
+		}
+		if cc := lv.GetString("resp_cc"); cc != nil {
+			dst.Location = &v1_5_0.GeoLocation{Country: cc}
+		}
+	}
+
+	connInfo := &v1_5_0.NetworkConnectionInformation{}
+	var ipVersion int32
+	if src != nil && src.Ip != nil {
+		id, name := zeekocsf.IPVersion(*src.Ip)
+		if id != 0 {
+			ipVersion = id
+			connInfo.ProtocolVerId = &id
+			connInfo.ProtocolVer = &name
+		}
+	}
+
+	var icmp *ICMP
+	if proto := lv.GetString("proto"); proto != nil {
+		num, name, ok := zeekocsf.Protocol(*proto)
+		// Zeek logs ICMPv6 as "icmp" too; the address family tells them apart.
+		if num == 1 && ipVersion == 6 {
+			num, name, ok = zeekocsf.Protocol("ipv6-icmp")
+		}
+		connInfo.ProtocolName = &name
+		if ok {
+			connInfo.ProtocolNum = &num
+		}
+
+		// For ICMP Zeek puts the message type in id.orig_p and the code in
+		// id.resp_p. They are not ports, so move them off the endpoints.
+		if ok && (num == 1 || num == 58) {
+			icmp = &ICMP{Type: lv.GetInt64("id.orig_p"), Code: lv.GetInt64("id.resp_p")}
+			if src != nil {
+				src.Port = nil
+			}
+			if dst != nil {
+				dst.Port = nil
+			}
+		}
+	}
+	if communityUid := lv.GetString("community_id"); communityUid != nil {
+		connInfo.CommunityUid = communityUid
+	}
+	if directionID != nil {
+		connInfo.DirectionId = *directionID
+	}
+	if h := lv.GetString("history"); h != nil {
+		connInfo.FlagHistory = h
+	}
+	if connInfo.ProtocolName == nil && connInfo.ProtocolNum == nil && connInfo.FlagHistory == nil && connInfo.ProtocolVerId == nil {
+		connInfo = nil
+	}
+
+	// Traffic counters
+	ob := lv.GetInt64("orig_bytes")
+	rb := lv.GetInt64("resp_bytes")
+	mb := lv.GetInt64("missed_bytes")
+	op := lv.GetInt64("orig_pkts")
+	rp := lv.GetInt64("resp_pkts")
+
+	var totalBytes, totalPkts *int64
+	if ob != nil || rb != nil || op != nil || rp != nil {
+		tb, tp := int64(0), int64(0)
+		if ob != nil {
+			tb += *ob
+		}
+		if rb != nil {
+			tb += *rb
+		}
+		if op != nil {
+			tp += *op
+		}
+		if rp != nil {
+			tp += *rp
+		}
+		totalBytes, totalPkts = &tb, &tp
+	}
+
+	var traffic *v1_5_0.NetworkTraffic
+	if ob != nil || rb != nil || mb != nil || op != nil || rp != nil {
+		traffic = &v1_5_0.NetworkTraffic{
+			BytesOut:    ob,
+			PacketsOut:  op,
+			BytesIn:     rb,
+			PacketsIn:   rp,
+			BytesMissed: mb,
+			Bytes:       totalBytes,
+			Packets:     totalPkts,
+		}
+	}
+
+	md := zeekocsf.Metadata(lv)
+
+	// A tunneled connection lists the uids of the connections carrying it
+	// (e.g. the outer Teredo or GRE flow, also in tunnel.log). The first
+	// parent becomes the correlation uid so the hop can be joined back.
+	tunnelParents, _ := lv.GetStringList("tunnel_parents")
+	if len(tunnelParents) > 0 {
+		md.CorrelationUid = &tunnelParents[0]
+	}
+
+	// Optional strings
+	var appName *string
+	if s := lv.GetString("service"); s != nil {
+		appName = s
+	}
+
+	objs := buildObservables(lv, src, dst, connInfo)
+
+	var unmapped OCSFUnMapped
+
+	if missedBytes := lv.GetInt64("missed_bytes"); missedBytes != nil {
+		unmapped.MissedBytes = missedBytes
+	}
+
+	if vlan := lv.GetInt64("vlan"); vlan != nil {
+		unmapped.VLAN = vlan
+	}
+
+	app, _ := lv.GetStringList("app")
+	unmapped.App = app
+
+	unmapped.TunnelParent = tunnelParents
+
+	suriIDs, _ := lv.GetStringList("suri_ids")
+	unmapped.SuriIDs = suriIDs
+
+	var sp SPCap
+	sp.Trigger = lv.GetString("spcap.trigger")
+
+	sp.URL = lv.GetString("spcap.url")
+
+	if rule := lv.GetInt64("spcap.rule"); rule != nil {
+		sp.Rule = rule
+	}
+
+	if localOrig != nil {
+		unmapped.LocalOrig = localOrig
+	}
+
+	if localResp != nil {
+		unmapped.LocalResp = localResp
+	}
+
+	if origIPBytes := lv.GetInt64("orig_ip_bytes"); origIPBytes != nil {
+		unmapped.OrigIPBytes = origIPBytes
+	}
+
+	if respIPBytes := lv.GetInt64("resp_ip_bytes"); respIPBytes != nil {
+		unmapped.RespIPBytes = respIPBytes
+	}
+
+	if pcr := lv.GetFloat64("pcr"); pcr != nil {
+		unmapped.Pcr = pcr
+	}
+
+	if corelightShunted := lv.GetBool("corelight_shunted"); corelightShunted != nil {
+		unmapped.CorelightShunted = corelightShunted
+	}
+	unmapped.SPCap = &sp
+	unmapped.ICMP = icmp
+
+	na := v1_5_0.NetworkActivity{
+		ActivityId:     activityID,
+		CategoryUid:    categoryUID,
+		ClassUid:       classUID,
+		SeverityId:     severityID,
+		TypeUid:        typeUID,
+		Time:           timeMs,
+		Metadata:       md,
+		AppName:        appName,
+		SrcEndpoint:    src,
+		DstEndpoint:    dst,
+		ConnectionInfo: connInfo,
+		Traffic:        traffic,
+		Duration:       duration,
+		Status:         status,
+		StatusCode:     statusCode,
+		StatusDetail:   statusDetail,
+		StatusId:       statusID,
+		Observables:    objs,
+		Unmapped:       zeekocsf.Unmapped(unmapped),
+	}
+	if duration != nil {
+		na.StartTime = startTime
+		na.EndTime = endTime
+	}
+
+	return &na, nil
+}
+
+/* ---------------- helpers: domain-specific ---------------- */
+
+// OCSF observable type_ids.
+const (
+	observableHostname int32 = 1
+	observableIP       int32 = 2
+	observableMAC      int32 = 3
+	observableOther    int32 = 99
+)
+
+// buildObservables lists the addresses, MACs, resolved host names and
+// community id of a conn as OCSF observables, in that order, source before
+// destination.
+func buildObservables(v tangent_sdk.Log, src, dst *v1_5_0.NetworkEndpoint, connInfo *v1_5_0.NetworkConnectionInformation) []v1_5_0.Observable {
+	var out []v1_5_0.Observable
+	add := func(name string, typeID int32, val *string) bool {
+		if val == nil || *val == "" {
+			return false
+		}
+		out = append(out, v1_5_0.Observable{Name: &name, TypeId: typeID, Value: val})
+		return true
+	}
+
+	if src != nil {
+		add("src_endpoint.ip", observableIP, src.Ip)
+	}
+	if dst != nil {
+		add("dst_endpoint.ip", observableIP, dst.Ip)
+	}
+	if src != nil {
+		add("src_endpoint.mac", observableMAC, src.Mac)
+	}
+	if dst != nil {
+		add("dst_endpoint.mac", observableMAC, dst.Mac)
+	}
+
+	// Zeek's *_h_name fields carry the names it saw for each host and where
+	// it saw them (DNS, HTTP Host, NTLM, ...). The source goes in reputation
+	// provider; Zeek gives no score, so without a source there is no
+	// reputation at all.
+	for _, side := range []struct{ prefix, name string }{
+		{"id.orig_h_name", "src_endpoint.hostname"},
+		{"id.resp_h_name", "dst_endpoint.hostname"},
+	} {
+		provider := v.GetString(side.prefix + ".src")
+		vals, _ := v.GetStringList(side.prefix + ".vals")
+		for i := range vals {
+			if add(side.name, observableHostname, &vals[i]) && provider != nil {
+				out[len(out)-1].Reputation = &v1_5_0.Reputation{Provider: provider}
+			}
+		}
+	}
+
+	if connInfo != nil && add("connection_info.community_uid", observableOther, connInfo.CommunityUid) {
+		typ := "Community ID"
+		out[len(out)-1].Type = &typ
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package mappers
+
+import (
+	"math"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type DHCPUnmapped struct {
+	MsgTypes      []string `json:"msg_types,omitempty"`
+	UIDs          []string `json:"uids,omitempty"`
+	RequestedAddr *string  `json:"requested_addr,omitempty"`
+	AssignedAddr  *string  `json:"assigned_addr,omitempty"`
+	ClientFQDN    *string  `json:"client_fqdn,omitempty"`
+	ClientMessage *string  `json:"client_message,omitempty"`
+	ServerMessage *string  `json:"server_message,omitempty"`
+}
+
+// msgPrecedence ranks the DHCP message types Zeek folds into one record,
+// most significant first: the server's verdict, then what the client gave
+// up, then the request, the offer and the discover that led to it. A full
+// DORA exchange is reported as an Ack.
+var msgPrecedence = []struct {
+	msg        string
+	activityID int32
+}{
+	{"ACK", 5},
+	{"NAK", 6},
+	{"DECLINE", 4},
+	{"RELEASE", 7},
+	{"REQUEST", 3},
+	{"OFFER", 2},
+	{"DISCOVER", 1},
+	{"INFORM", 8},
+}
+
+func MapZeekDHCP(lv tangent_sdk.Log) (*v1_5_0.DHCPActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4004 // dhcp_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	msgTypes, _ := lv.GetStringList("msg_types")
+	activityID := dhcpActivity(msgTypes)
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	var status *string
+	var statusID *int32
+	switch activityID {
+	case 5:
+		s, id := "Success", int32(1)
+		status, statusID = &s, &id
+	case 4, 6:
+		s, id := "Failure", int32(2)
+		status, statusID = &s, &id
+	}
+
+	// DHCP records aggregate several connections; the first uid stands in
+	// for metadata.uid and the rest stay in unmapped.
+	md := zeekocsf.Metadata(lv)
+	uids, _ := lv.GetStringList("uids")
+	if len(uids) > 0 {
+		md.Uid = &uids[0]
+	}
+
+	hostName := lv.GetString("host_name")
+	domain := lv.GetString("domain")
+	mac := lv.GetString("mac")
+	assigned := lv.GetString("assigned_addr")
+
+	src := endpoint(lv.GetString("client_addr"), lv.GetInt64("client_port"))
+	if src == nil && (mac != nil || hostName != nil) {
+		src = &v1_5_0.NetworkEndpoint{}
+	}
+	if src != nil {
+		src.Mac = mac
+		src.Hostname = hostName
+		src.Domain = domain
+	}
+	dst := endpoint(lv.GetString("server_addr"), lv.GetInt64("server_port"))
+
+	var device *v1_5_0.Device
+	if hostName != nil || domain != nil || mac != nil || assigned != nil {
+		device = &v1_5_0.Device{
+			Hostname: hostName,
+			Domain:   domain,
+			Mac:      mac,
+			Ip:       assigned,
+		}
+	}
+
+	var leaseDur *int32
+	if lt := lv.GetFloat64("lease_time"); lt != nil {
+		d := int32(math.Round(*lt))
+		leaseDur = &d
+	} else if lt := lv.GetInt64("lease_time"); lt != nil {
+		d := int32(*lt)
+		leaseDur = &d
+	}
+
+	var duration *int64
+	if d := lv.GetFloat64("duration"); d != nil {
+		ms := int64(math.Round(*d * 1000))
+		duration = &ms
+	}
+
+	var unmapped DHCPUnmapped
+	unmapped.MsgTypes = msgTypes
+	unmapped.UIDs = uids
+	unmapped.RequestedAddr = lv.GetString("requested_addr")
+	unmapped.AssignedAddr = assigned
+	unmapped.ClientFQDN = lv.GetString("client_fqdn")
+	unmapped.ClientMessage = lv.GetString("client_message")
+	unmapped.ServerMessage = lv.GetString("server_message")
+
+	da := v1_5_0.DHCPActivity{
+		ActivityId:  activityID,
+		CategoryUid: categoryUID,
+		ClassUid:    classUID,
+		SeverityId:  severityID,
+		TypeUid:     typeUID,
+		Time:        timeMs,
+		Metadata:    md,
+		SrcEndpoint: src,
+		DstEndpoint: dst,
+		Device:      device,
+		LeaseDur:    leaseDur,
+		Duration:    duration,
+		Status:      status,
+		StatusId:    statusID,
+		Unmapped:    zeekocsf.Unmapped(unmapped),
+	}
+	if duration != nil {
+		da.StartTime = timeMs
+		da.EndTime = timeMs + *duration
+	}
+	return &da, nil
+}
+
+// dhcpActivity picks the most significant message in msg_types according
+// to msgPrecedence; 99 (other) if none are recognised.
+func dhcpActivity(msgTypes []string) int32 {
+	if len(msgTypes) == 0 {
+		return 0
+	}
+	for _, p := range msgPrecedence {
+		for _, m := range msgTypes {
+			if m == p.msg {
+				return p.activityID
+			}
+		}
+	}
+	return 99
+}
+
+func endpoint(ip *string, port *int64) *v1_5_0.NetworkEndpoint {
+	if ip == nil {
+		return nil
+	}
+	p := 0
+	if port != nil {
+		p = int(*port)
+	}
+	return zeekocsf.NetEndpoint(*ip, p)
+}
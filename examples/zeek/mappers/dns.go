@@ -0,0 +1,264 @@
+package mappers
+
+import (
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+// TTLMismatch records answers and TTLs arrays of different lengths. Answers
+// past the last TTL have none; TTLs past the last answer are kept here.
+type TTLMismatch struct {
+	Answers   int       `json:"answers"`
+	TTLs      int       `json:"ttls"`
+	ExtraTTLs []float64 `json:"extra_ttls,omitempty"`
+}
+
+type DNSUnmapped struct {
+	TransID     *int64       `json:"trans_id,omitempty"`
+	RTT         *float64     `json:"rtt,omitempty"`
+	QClass      *int64       `json:"qclass,omitempty"`
+	QType       *int64       `json:"qtype,omitempty"`
+	Z           *int64       `json:"Z,omitempty"`
+	Rejected    *bool        `json:"rejected,omitempty"`
+	TTLMismatch *TTLMismatch `json:"ttl_mismatch,omitempty"`
+}
+
+// nameTypes are query types whose answers are domain names. Names answering
+// any other query (an A lookup, say) are the CNAME chain that led to it.
+var nameTypes = map[string]bool{
+	"CNAME": true,
+	"DNAME": true,
+	"MX":    true,
+	"NS":    true,
+	"PTR":   true,
+	"SRV":   true,
+}
+
+// answerFlags are the header bits Zeek logs, with their OCSF flag ids.
+var answerFlags = []struct {
+	field string
+	name  string
+	id    int32
+}{
+	{"AA", "Authoritative Answer", 1},
+	{"TC", "Truncated Response", 2},
+	{"RD", "Recursion Desired", 3},
+	{"RA", "Recursion Available", 4},
+}
+
+func MapZeekDNS(lv tangent_sdk.Log) (*v1_5_0.DNSActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4003 // dns_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	rcode := lv.GetInt64("rcode")
+	var activityID int32 = 1 // query
+	if rcode != nil {
+		activityID = 2 // response
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	qtype := lv.GetString("qtype_name")
+	var query *v1_5_0.DNSQuery
+	if q := lv.GetString("query"); q != nil {
+		query = &v1_5_0.DNSQuery{
+			Hostname: *q,
+			Class:    lv.GetString("qclass_name"),
+			Type:     qtype,
+		}
+	}
+
+	var flags []string
+	var flagIDs []int32
+	for _, f := range answerFlags {
+		if b := lv.GetBool(f.field); b != nil && *b {
+			flags = append(flags, f.name)
+			flagIDs = append(flagIDs, f.id)
+		}
+	}
+
+	// Zeek logs answers and TTLs as parallel arrays; they should be the same
+	// length, but when they are not nothing is dropped.
+	answers, _ := lv.GetStringList("answers")
+	ttls := ttlList(lv)
+	var unmapped DNSUnmapped
+	if len(answers) != len(ttls) && len(ttls) > 0 {
+		unmapped.TTLMismatch = &TTLMismatch{Answers: len(answers), TTLs: len(ttls)}
+		if len(ttls) > len(answers) {
+			unmapped.TTLMismatch.ExtraTTLs = ttls[len(answers):]
+		}
+	}
+
+	var out []v1_5_0.DNSAnswer
+	var observables []v1_5_0.Observable
+	if query != nil && query.Hostname != "" {
+		name := "query.hostname"
+		observables = append(observables, v1_5_0.Observable{Name: &name, TypeId: 1, Value: &query.Hostname})
+	}
+	var qtypeName string
+	if qtype != nil {
+		qtypeName = *qtype
+	}
+	for i, a := range answers {
+		rdata, typ, isIP := classifyAnswer(a, qtypeName)
+		ans := v1_5_0.DNSAnswer{
+			Rdata:   rdata,
+			Type:    &typ,
+			Flags:   flags,
+			FlagIds: flagIDs,
+		}
+		if i < len(ttls) {
+			ttl := int32(math.Round(ttls[i]))
+			ans.Ttl = &ttl
+		}
+		out = append(out, ans)
+		if isIP {
+			name := "answers.rdata"
+			observables = append(observables, v1_5_0.Observable{Name: &name, TypeId: 2, Value: &rdata})
+		}
+	}
+
+	var rcodeID *int32
+	var status *string
+	var statusID *int32
+	if rcode != nil {
+		id := ocsfRcode(*rcode)
+		rcodeID = &id
+		s, sid := "Failure", int32(2)
+		if *rcode == 0 {
+			s, sid = "Success", 1
+		}
+		status, statusID = &s, &sid
+	}
+
+	var responseTime int64
+	rtt := lv.GetFloat64("rtt")
+	if rtt != nil {
+		responseTime = timeMs + int64(math.Round(*rtt*1000))
+	}
+
+	unmapped.TransID = lv.GetInt64("trans_id")
+	unmapped.RTT = rtt
+	unmapped.QClass = lv.GetInt64("qclass")
+	unmapped.QType = lv.GetInt64("qtype")
+	unmapped.Z = lv.GetInt64("Z")
+	unmapped.Rejected = lv.GetBool("rejected")
+
+	return &v1_5_0.DNSActivity{
+		ActivityId:   activityID,
+		CategoryUid:  categoryUID,
+		ClassUid:     classUID,
+		SeverityId:   severityID,
+		TypeUid:      typeUID,
+		Time:         timeMs,
+		Metadata:     zeekocsf.Metadata(lv),
+		SrcEndpoint:  src,
+		DstEndpoint:  dst,
+		Query:        query,
+		Answers:      out,
+		QueryTime:    timeMs,
+		ResponseTime: responseTime,
+		Rcode:        lv.GetString("rcode_name"),
+		RcodeId:      rcodeID,
+		Status:       status,
+		StatusId:     statusID,
+		Observables:  observables,
+		Unmapped:     zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// classifyAnswer works out the record type of one entry in Zeek's answers
+// array, which holds addresses, names and free text side by side.
+// Addresses are A or AAAA; names are the query type when it answers with
+// names and CNAME otherwise; anything else is TXT.
+func classifyAnswer(a, qtype string) (rdata, typ string, isIP bool) {
+	if addr, err := netip.ParseAddr(a); err == nil {
+		addr = addr.WithZone("").Unmap()
+		if addr.Is4() {
+			return addr.String(), "A", true
+		}
+		return addr.String(), "AAAA", true
+	}
+	if looksLikeName(a) {
+		if nameTypes[qtype] {
+			return a, qtype, false
+		}
+		return a, "CNAME", false
+	}
+	return a, "TXT", false
+}
+
+// looksLikeName reports whether s is a dotted domain name: two or more
+// labels of letters, digits, hyphens and underscores, with an optional
+// trailing dot.
+func looksLikeName(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 {
+			return false
+		}
+		for _, c := range l {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ocsfRcode maps a DNS RCODE onto OCSF rcode_id, which follows the IANA
+// values it enumerates and uses 99 for the rest.
+func ocsfRcode(rcode int64) int32 {
+	switch {
+	case rcode >= 0 && rcode <= 11, rcode >= 16 && rcode <= 23:
+		return int32(rcode)
+	default:
+		return 99
+	}
+}
+
+// ttlList reads Zeek's TTLs. They are intervals and normally logged as
+// floats, but some exporters write whole seconds as integers, and TSV logs
+// arrive as strings.
+func ttlList(lv tangent_sdk.Log) []float64 {
+	fs, _ := lv.GetFloat64List("TTLs")
+	is, _ := lv.GetInt64List("TTLs")
+	if len(is) > len(fs) {
+		fs = fs[:0]
+		for _, i := range is {
+			fs = append(fs, float64(i))
+		}
+	}
+	if len(fs) == 0 {
+		ss, _ := lv.GetStringList("TTLs")
+		for _, s := range ss {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil
+			}
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
@@ -0,0 +1,3 @@
+// Package mappers turns each Zeek log type into its OCSF class. The per-log
+// plugins and the all/ dispatcher wire these same functions.
+package mappers
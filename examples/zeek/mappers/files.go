@@ -0,0 +1,167 @@
+package mappers
+
+import (
+	"math"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type FilesUnmapped struct {
+	TxHosts       []string `json:"tx_hosts,omitempty"`
+	RxHosts       []string `json:"rx_hosts,omitempty"`
+	ConnUIDs      []string `json:"conn_uids,omitempty"`
+	Source        *string  `json:"source,omitempty"`
+	Depth         *int64   `json:"depth,omitempty"`
+	Analyzers     []string `json:"analyzers,omitempty"`
+	IsOrig        *bool    `json:"is_orig,omitempty"`
+	LocalOrig     *bool    `json:"local_orig,omitempty"`
+	SeenBytes     *int64   `json:"seen_bytes,omitempty"`
+	MissingBytes  *int64   `json:"missing_bytes,omitempty"`
+	OverflowBytes *int64   `json:"overflow_bytes,omitempty"`
+	TimedOut      *bool    `json:"timedout,omitempty"`
+	Extracted     *string  `json:"extracted,omitempty"`
+}
+
+// OCSF observable type_id for a hash.
+const observableHash int32 = 8
+
+func MapZeekFiles(lv tangent_sdk.Log) (*v1_5_0.NetworkFileActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4010 // network_file_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	// The originator sent the file (upload) or received it (download).
+	var activityID int32 = 0
+	isOrig := lv.GetBool("is_orig")
+	if isOrig != nil {
+		if *isOrig {
+			activityID = 1 // upload
+		} else {
+			activityID = 2 // download
+		}
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	md := zeekocsf.Metadata(lv)
+	md.Uid = lv.GetString("fuid")
+
+	// Zeek before 5.0 lists every connection the file crossed in conn_uids;
+	// newer versions log a single uid with the connection tuple.
+	connUIDs, _ := lv.GetStringList("conn_uids")
+	if uid := lv.GetString("uid"); uid != nil {
+		md.CorrelationUid = uid
+	} else if len(connUIDs) > 0 {
+		md.CorrelationUid = &connUIDs[0]
+	}
+
+	txHosts, _ := lv.GetStringList("tx_hosts")
+	rxHosts, _ := lv.GetStringList("rx_hosts")
+	var src v1_5_0.NetworkEndpoint
+	var dst *v1_5_0.NetworkEndpoint
+	if len(txHosts) > 0 || len(rxHosts) > 0 {
+		if len(txHosts) > 0 {
+			src = *zeekocsf.NetEndpoint(txHosts[0], 0)
+		}
+		if len(rxHosts) > 0 {
+			dst = zeekocsf.NetEndpoint(rxHosts[0], 0)
+		}
+	} else {
+		orig, resp := zeekocsf.Endpoints(lv)
+		if isOrig != nil && !*isOrig {
+			orig, resp = resp, orig
+		}
+		if orig != nil {
+			src = *orig
+		}
+		dst = resp
+	}
+
+	file := v1_5_0.File{
+		TypeId:   1, // regular file
+		Uid:      md.Uid,
+		MimeType: lv.GetString("mime_type"),
+		Size:     lv.GetInt64("total_bytes"),
+	}
+	if name := lv.GetString("filename"); name != nil {
+		file.Name = *name
+	}
+
+	var observables []v1_5_0.Observable
+	for _, h := range []struct {
+		field string
+		alg   string
+		algID int32
+	}{
+		{"md5", "MD5", 1},
+		{"sha1", "SHA-1", 2},
+		{"sha256", "SHA-256", 3},
+	} {
+		v := lv.GetString(h.field)
+		if v == nil {
+			continue
+		}
+		alg := h.alg
+		file.Hashes = append(file.Hashes, v1_5_0.Fingerprint{
+			Algorithm:   &alg,
+			AlgorithmId: h.algID,
+			Value:       *v,
+		})
+		name := "file.hashes"
+		observables = append(observables, v1_5_0.Observable{
+			Name:   &name,
+			TypeId: observableHash,
+			Value:  v,
+		})
+	}
+
+	var duration *int64
+	if d := lv.GetFloat64("duration"); d != nil {
+		ms := int64(math.Round(*d * 1000))
+		duration = &ms
+	}
+
+	var unmapped FilesUnmapped
+	unmapped.TxHosts = txHosts
+	unmapped.RxHosts = rxHosts
+	unmapped.ConnUIDs = connUIDs
+	unmapped.Source = lv.GetString("source")
+	unmapped.Depth = lv.GetInt64("depth")
+	unmapped.Analyzers, _ = lv.GetStringList("analyzers")
+	unmapped.IsOrig = isOrig
+	unmapped.LocalOrig = lv.GetBool("local_orig")
+	unmapped.SeenBytes = lv.GetInt64("seen_bytes")
+	unmapped.MissingBytes = lv.GetInt64("missing_bytes")
+	unmapped.OverflowBytes = lv.GetInt64("overflow_bytes")
+	unmapped.TimedOut = lv.GetBool("timedout")
+	unmapped.Extracted = lv.GetString("extracted")
+
+	na := v1_5_0.NetworkFileActivity{
+		ActivityId:  activityID,
+		CategoryUid: categoryUID,
+		ClassUid:    classUID,
+		SeverityId:  severityID,
+		TypeUid:     typeUID,
+		Time:        timeMs,
+		Metadata:    md,
+		SrcEndpoint: src,
+		DstEndpoint: dst,
+		File:        file,
+		Duration:    duration,
+		Observables: observables,
+		Unmapped:    zeekocsf.Unmapped(unmapped),
+	}
+	if duration != nil {
+		na.StartTime = timeMs
+		na.EndTime = timeMs + *duration
+	}
+	return &na, nil
+}
@@ -0,0 +1,133 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type KerberosUnmapped struct {
+	Cipher            *string `json:"cipher,omitempty"`
+	Forwardable       *bool   `json:"forwardable,omitempty"`
+	Renewable         *bool   `json:"renewable,omitempty"`
+	ClientCertSubject *string `json:"client_cert_subject,omitempty"`
+	ClientCertFUID    *string `json:"client_cert_fuid,omitempty"`
+	ServerCertSubject *string `json:"server_cert_subject,omitempty"`
+	ServerCertFUID    *string `json:"server_cert_fuid,omitempty"`
+}
+
+func MapZeekKerberos(lv tangent_sdk.Log) (*v1_5_0.Authentication, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 3002 // authentication
+	const categoryUID int32 = 3 // Identity & Access Management
+	var severityID int32 = 1
+
+	// AS requests ask the KDC for a TGT, TGS requests trade one for a
+	// service ticket.
+	var activityID int32 = 99 // other
+	var token *v1_5_0.AuthenticationToken
+	var requestType string
+	if rt := lv.GetString("request_type"); rt != nil {
+		requestType = *rt
+	}
+	switch requestType {
+	case "AS":
+		activityID = 3 // authentication ticket
+		t, id := "Ticket Granting Ticket", int32(1)
+		token = &v1_5_0.AuthenticationToken{Type: &t, TypeId: &id}
+	case "TGS":
+		activityID = 4 // service ticket request
+		t, id := "Service Ticket", int32(2)
+		token = &v1_5_0.AuthenticationToken{Type: &t, TypeId: &id}
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	var status *string
+	var statusID *int32
+	if ok := lv.GetBool("success"); ok != nil {
+		s, id := "Failure", int32(2)
+		if *ok {
+			s, id = "Success", 1
+		}
+		status, statusID = &s, &id
+	}
+
+	var user v1_5_0.User
+	if client := lv.GetString("client"); client != nil {
+		user.Name, user.Domain = splitPrincipal(*client)
+	}
+
+	// The service principal is kept whole: for krbtgt/REALM and SPNs like
+	// MSSQLSvc/host:1433 every component is part of the name.
+	var service *v1_5_0.Service
+	if svc := lv.GetString("service"); svc != nil {
+		service = &v1_5_0.Service{Name: svc}
+	}
+
+	from, fromOK, _ := zeekocsf.GetTime(lv, "from")
+	till, tillOK, _ := zeekocsf.GetTime(lv, "till")
+	if fromOK || tillOK {
+		if token == nil {
+			token = &v1_5_0.AuthenticationToken{}
+		}
+		token.CreatedTime = from
+		token.ExpirationTime = till
+	}
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	authProtocol, authProtocolID := "Kerberos", int32(2)
+
+	var unmapped KerberosUnmapped
+	unmapped.Cipher = lv.GetString("cipher")
+	unmapped.Forwardable = lv.GetBool("forwardable")
+	unmapped.Renewable = lv.GetBool("renewable")
+	unmapped.ClientCertSubject = lv.GetString("client_cert_subject")
+	unmapped.ClientCertFUID = lv.GetString("client_cert_fuid")
+	unmapped.ServerCertSubject = lv.GetString("server_cert_subject")
+	unmapped.ServerCertFUID = lv.GetString("server_cert_fuid")
+
+	return &v1_5_0.Authentication{
+		ActivityId:          activityID,
+		CategoryUid:         categoryUID,
+		ClassUid:            classUID,
+		SeverityId:          severityID,
+		TypeUid:             typeUID,
+		Time:                timeMs,
+		Metadata:            zeekocsf.Metadata(lv),
+		SrcEndpoint:         src,
+		DstEndpoint:         dst,
+		User:                user,
+		Service:             service,
+		AuthProtocol:        &authProtocol,
+		AuthProtocolId:      &authProtocolID,
+		AuthenticationToken: token,
+		Status:              status,
+		StatusDetail:        lv.GetString("error_msg"),
+		StatusId:            statusID,
+		Unmapped:            zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// splitPrincipal splits a Zeek client principal ("jdoe/CORP.EXAMPLE.ORG")
+// into user name and realm. Multi-component names such as host/ws01 keep
+// everything before the last slash.
+func splitPrincipal(p string) (name, realm *string) {
+	i := strings.LastIndexByte(p, '/')
+	if i < 0 {
+		return &p, nil
+	}
+	n, r := p[:i], p[i+1:]
+	if r == "" {
+		return &n, nil
+	}
+	return &n, &r
+}
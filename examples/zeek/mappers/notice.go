@@ -0,0 +1,121 @@
+package mappers
+
+import (
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type NoticeUnmapped struct {
+	Actions     []string `json:"actions,omitempty"`
+	EmailDest   []string `json:"email_dest,omitempty"`
+	SuppressFor *float64 `json:"suppress_for,omitempty"`
+	Dropped     *bool    `json:"dropped,omitempty"`
+	PeerDescr   *string  `json:"peer_descr,omitempty"`
+	Fuid        *string  `json:"fuid,omitempty"`
+	FileMime    *string  `json:"file_mime_type,omitempty"`
+	FileDesc    *string  `json:"file_desc,omitempty"`
+	Proto       *string  `json:"proto,omitempty"`
+}
+
+func MapZeekNotice(lv tangent_sdk.Log) (*v1_5_0.DetectionFinding, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 2004 // detection_finding
+	const categoryUID int32 = 2 // Findings
+	const activityID int32 = 1  // create
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	var note string
+	if n := lv.GetString("note"); n != nil {
+		note = *n
+	}
+	severityID := zeekocsf.NoticeSeverityID(note)
+	severity := zeekocsf.SeverityName(severityID)
+
+	info := v1_5_0.FindingInformation{
+		Title: &note,
+		Types: []string{note},
+		Desc:  lv.GetString("sub"),
+	}
+	if uid := lv.GetString("uid"); uid != nil {
+		info.Uid = *uid
+	} else if fuid := lv.GetString("fuid"); fuid != nil {
+		info.Uid = *fuid
+	}
+
+	var count *int32
+	if n := lv.GetInt64("n"); n != nil {
+		c := int32(*n)
+		count = &c
+	}
+
+	var evidences []v1_5_0.EvidenceArtifacts
+	if src, dst := noticeEndpoints(lv); src != nil || dst != nil {
+		evidences = []v1_5_0.EvidenceArtifacts{{SrcEndpoint: src, DstEndpoint: dst}}
+	}
+
+	var unmapped NoticeUnmapped
+	unmapped.Actions, _ = lv.GetStringList("actions")
+	unmapped.EmailDest, _ = lv.GetStringList("email_dest")
+	unmapped.SuppressFor = lv.GetFloat64("suppress_for")
+	if unmapped.SuppressFor == nil {
+		if s := lv.GetInt64("suppress_for"); s != nil {
+			f := float64(*s)
+			unmapped.SuppressFor = &f
+		}
+	}
+	unmapped.Dropped = lv.GetBool("dropped")
+	unmapped.PeerDescr = lv.GetString("peer_descr")
+	unmapped.Fuid = lv.GetString("fuid")
+	unmapped.FileMime = lv.GetString("file_mime_type")
+	unmapped.FileDesc = lv.GetString("file_desc")
+	unmapped.Proto = lv.GetString("proto")
+
+	isAlert := true
+	status, statusID := "New", int32(1)
+
+	return &v1_5_0.DetectionFinding{
+		ActivityId:  activityID,
+		CategoryUid: categoryUID,
+		ClassUid:    classUID,
+		SeverityId:  severityID,
+		Severity:    &severity,
+		TypeUid:     typeUID,
+		Time:        timeMs,
+		Metadata:    zeekocsf.Metadata(lv),
+		FindingInfo: info,
+		Message:     lv.GetString("msg"),
+		Count:       count,
+		Evidences:   evidences,
+		IsAlert:     &isAlert,
+		Status:      &status,
+		StatusId:    &statusID,
+		Unmapped:    zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// noticeEndpoints prefers the connection tuple; notices raised outside a
+// connection (scans, intel hits) only carry src, dst and p.
+func noticeEndpoints(lv tangent_sdk.Log) (src, dst *v1_5_0.NetworkEndpoint) {
+	src, dst = zeekocsf.Endpoints(lv)
+	if src != nil || dst != nil {
+		return src, dst
+	}
+	if s := lv.GetString("src"); s != nil {
+		src = zeekocsf.NetEndpoint(*s, 0)
+	}
+	if d := lv.GetString("dst"); d != nil {
+		port := 0
+		if p := lv.GetInt64("p"); p != nil {
+			port = int(*p)
+		}
+		dst = zeekocsf.NetEndpoint(*d, port)
+	}
+	return src, dst
+}
@@ -0,0 +1,105 @@
+package mappers
+
+import (
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type NTPUnmapped struct {
+	Version   *int64   `json:"version,omitempty"`
+	Mode      *int64   `json:"mode,omitempty"`
+	ModeName  *string  `json:"mode_name,omitempty"`
+	Stratum   *int64   `json:"stratum,omitempty"`
+	Poll      *float64 `json:"poll,omitempty"`
+	Precision *float64 `json:"precision,omitempty"`
+	RootDelay *float64 `json:"root_delay,omitempty"`
+	RootDisp  *float64 `json:"root_disp,omitempty"`
+	RefID     *string  `json:"ref_id,omitempty"`
+	RefTime   *int64   `json:"ref_time,omitempty"`
+	OrgTime   *int64   `json:"org_time,omitempty"`
+	RecTime   *int64   `json:"rec_time,omitempty"`
+	XmtTime   *int64   `json:"xmt_time,omitempty"`
+	NumExts   *int64   `json:"num_exts,omitempty"`
+}
+
+// modeNames are the NTP association modes from RFC 5905, plus the mode 7
+// private messages ntpd uses for ntpdc (including monlist).
+var modeNames = map[int64]string{
+	1: "symmetric active",
+	2: "symmetric passive",
+	3: "client",
+	4: "server",
+	5: "broadcast",
+	6: "control",
+	7: "private",
+}
+
+func MapZeekNTP(lv tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4001 // network_activity
+	const categoryUID int32 = 4 // Network Activity
+	const activityID int32 = 6  // traffic
+	var severityID int32 = 1
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	protoName, protoNum := "NTP", int32(17)
+	connInfo := &v1_5_0.NetworkConnectionInformation{
+		ProtocolName: &protoName,
+		ProtocolNum:  &protoNum,
+	}
+
+	var unmapped NTPUnmapped
+	unmapped.Version = lv.GetInt64("version")
+	unmapped.Mode = lv.GetInt64("mode")
+	if unmapped.Mode != nil {
+		if name, ok := modeNames[*unmapped.Mode]; ok {
+			unmapped.ModeName = &name
+		}
+	}
+	// Control (6) and private (7) messages have none of the standard header
+	// fields below, so they are simply absent for those modes.
+	unmapped.Stratum = lv.GetInt64("stratum")
+	unmapped.Poll = lv.GetFloat64("poll")
+	unmapped.Precision = lv.GetFloat64("precision")
+	unmapped.RootDelay = lv.GetFloat64("root_delay")
+	unmapped.RootDisp = lv.GetFloat64("root_disp")
+	unmapped.RefID = lv.GetString("ref_id")
+	unmapped.RefTime = timeField(lv, "ref_time")
+	unmapped.OrgTime = timeField(lv, "org_time")
+	unmapped.RecTime = timeField(lv, "rec_time")
+	unmapped.XmtTime = timeField(lv, "xmt_time")
+	unmapped.NumExts = lv.GetInt64("num_exts")
+
+	return &v1_5_0.NetworkActivity{
+		ActivityId:     activityID,
+		CategoryUid:    categoryUID,
+		ClassUid:       classUID,
+		SeverityId:     severityID,
+		TypeUid:        typeUID,
+		Time:           timeMs,
+		Metadata:       zeekocsf.Metadata(lv),
+		SrcEndpoint:    src,
+		DstEndpoint:    dst,
+		ConnectionInfo: connInfo,
+		Unmapped:       zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// timeField reads an NTP timestamp as epoch milliseconds. Unparseable
+// values are dropped rather than failing the record.
+func timeField(lv tangent_sdk.Log, path string) *int64 {
+	ms, ok, err := zeekocsf.GetTime(lv, path)
+	if !ok || err != nil {
+		return nil
+	}
+	return &ms
+}
@@ -0,0 +1,151 @@
+package mappers
+
+import (
+	"strconv"
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type RDPCert struct {
+	Type      *string `json:"type,omitempty"`
+	Count     *int64  `json:"count,omitempty"`
+	Permanent *bool   `json:"permanent,omitempty"`
+}
+
+type RDPUnmapped struct {
+	Result              *string  `json:"result,omitempty"`
+	SecurityProtocol    *string  `json:"security_protocol,omitempty"`
+	SSL                 *bool    `json:"ssl,omitempty"`
+	ClientChannels      []string `json:"client_channels,omitempty"`
+	ClientBuild         *string  `json:"client_build,omitempty"`
+	ClientDigProductID  *string  `json:"client_dig_product_id,omitempty"`
+	RequestedColorDepth *string  `json:"requested_color_depth,omitempty"`
+	EncryptionLevel     *string  `json:"encryption_level,omitempty"`
+	EncryptionMethod    *string  `json:"encryption_method,omitempty"`
+	Cert                *RDPCert `json:"cert,omitempty"`
+	Inferences          []string `json:"inferences,omitempty"`
+}
+
+func MapZeekRDP(lv tangent_sdk.Log) (*v1_5_0.RDPActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4005 // rdp_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	cookie := lv.GetString("cookie")
+	result := lv.GetString("result")
+
+	// Once the session switches to TLS/CredSSP Zeek only sees the
+	// negotiation: the cookie from the initial request and, if the server
+	// answered, a result.
+	var activityID int32 = 6 // traffic
+	switch {
+	case result != nil:
+		activityID = 4 // connect response
+	case cookie != nil:
+		activityID = 1 // initial request
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	var status *string
+	var statusID *int32
+	if result != nil {
+		s, id := "Failure", int32(2)
+		switch strings.ToLower(*result) {
+		case "success":
+			s, id = "Success", 1
+		case "encrypted":
+			s, id = "Unknown", 0
+		}
+		status, statusID = &s, &id
+	}
+
+	src, dst := zeekocsf.Endpoints(lv)
+	if clientName := lv.GetString("client_name"); clientName != nil && src != nil {
+		src.Hostname = clientName
+	}
+
+	// mstshash=<user> is the only username RDP sends in the clear, and the
+	// client can put anything there.
+	var actor *v1_5_0.Actor
+	if cookie != nil {
+		if _, user, ok := strings.Cut(*cookie, "="); ok && user != "" {
+			actor = &v1_5_0.Actor{User: &v1_5_0.User{Name: &user}}
+		}
+	}
+
+	var keyboard *v1_5_0.KeyboardInformation
+	if kl := lv.GetString("keyboard_layout"); kl != nil {
+		keyboard = &v1_5_0.KeyboardInformation{KeyboardLayout: kl}
+	}
+
+	var display *v1_5_0.Display
+	width := lv.GetInt64("desktop_width")
+	height := lv.GetInt64("desktop_height")
+	if width != nil || height != nil {
+		display = &v1_5_0.Display{PhysicalWidth: int32Ptr(width), PhysicalHeight: int32Ptr(height)}
+		if cd := lv.GetString("requested_color_depth"); cd != nil {
+			if n, err := strconv.Atoi(strings.TrimSuffix(*cd, "bit")); err == nil {
+				depth := int32(n)
+				display.ColorDepth = &depth
+			}
+		}
+	}
+
+	var unmapped RDPUnmapped
+	unmapped.Result = result
+	unmapped.SecurityProtocol = lv.GetString("security_protocol")
+	unmapped.SSL = lv.GetBool("ssl")
+	unmapped.ClientChannels, _ = lv.GetStringList("client_channels")
+	unmapped.ClientBuild = lv.GetString("client_build")
+	unmapped.ClientDigProductID = lv.GetString("client_dig_product_id")
+	unmapped.RequestedColorDepth = lv.GetString("requested_color_depth")
+	unmapped.EncryptionLevel = lv.GetString("encryption_level")
+	unmapped.EncryptionMethod = lv.GetString("encryption_method")
+	cert := RDPCert{
+		Type:      lv.GetString("cert_type"),
+		Count:     lv.GetInt64("cert_count"),
+		Permanent: lv.GetBool("cert_permanent"),
+	}
+	if cert.Type != nil || cert.Count != nil || cert.Permanent != nil {
+		unmapped.Cert = &cert
+	}
+	unmapped.Inferences, _ = lv.GetStringList("inferences")
+
+	return &v1_5_0.RDPActivity{
+		ActivityId:       activityID,
+		CategoryUid:      categoryUID,
+		ClassUid:         classUID,
+		SeverityId:       severityID,
+		TypeUid:          typeUID,
+		Time:             timeMs,
+		Metadata:         zeekocsf.Metadata(lv),
+		SrcEndpoint:      src,
+		DstEndpoint:      dst,
+		Actor:            actor,
+		IdentifierCookie: cookie,
+		KeyboardInfo:     keyboard,
+		RemoteDisplay:    display,
+		Status:           status,
+		StatusDetail:     result,
+		StatusId:         statusID,
+		Unmapped:         zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+func int32Ptr(v *int64) *int32 {
+	if v == nil {
+		return nil
+	}
+	n := int32(*v)
+	return &n
+}
@@ -0,0 +1,105 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+// SeverityFn scores a conn record as an OCSF severity_id.
+type SeverityFn func(lv tangent_sdk.Log) int32
+
+// Option configures the conn mapper built by NewZeekMapper.
+type Option func(*connMapper)
+
+// WithSeverityFn replaces DefaultSeverity as the conn severity scorer.
+func WithSeverityFn(fn SeverityFn) Option {
+	return func(m *connMapper) {
+		m.severity = fn
+	}
+}
+
+type connMapper struct {
+	severity SeverityFn
+}
+
+// NewZeekMapper returns the conn.log mapper, scored with DefaultSeverity
+// unless an option says otherwise.
+func NewZeekMapper(opts ...Option) func(tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	m := &connMapper{severity: DefaultSeverity}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m.mapConn
+}
+
+// Thresholds used by DefaultSeverity.
+const (
+	// rejectedPkts is how many unanswered packets a rejected or reset
+	// connection needs before it looks like a probe rather than a typo.
+	rejectedPkts = 10
+	// longFlowSeconds and bulkFlowBytes mark a flow as long-lived and
+	// high-volume.
+	longFlowSeconds = 3600
+	bulkFlowBytes   = 100 << 20
+)
+
+// commonPorts are responder ports where long, heavy flows are routine.
+var commonPorts = map[int64]bool{
+	22: true, 53: true, 80: true, 123: true, 443: true, 445: true,
+	873: true, 993: true, 995: true, 1194: true, 3389: true,
+	5222: true, 8080: true, 8443: true,
+}
+
+// DefaultSeverity ranks a conn record from its state, history and volume.
+// Each rule proposes a severity and the highest wins:
+//
+//   - REJ or RSTO with no response bytes and rejectedPkts or more
+//     originator packets (a rejected burst): Medium.
+//   - A SYN from the originator never answered by a SYN-ACK (history has
+//     "S" but no "h"), the shape of a scan probe: Low.
+//   - A flow lasting longFlowSeconds with bulkFlowBytes or more to a port
+//     outside commonPorts: Low.
+//
+// Everything else is Informational.
+func DefaultSeverity(lv tangent_sdk.Log) int32 {
+	severity := zeekocsf.SeverityInformational
+	raise := func(s int32) {
+		if s > severity {
+			severity = s
+		}
+	}
+
+	respBytes := int64Or(lv.GetInt64("resp_bytes"))
+	origBytes := int64Or(lv.GetInt64("orig_bytes"))
+	origPkts := int64Or(lv.GetInt64("orig_pkts"))
+
+	if cs := lv.GetString("conn_state"); cs != nil && (*cs == "REJ" || *cs == "RSTO") {
+		if respBytes == 0 && origPkts >= rejectedPkts {
+			raise(zeekocsf.SeverityMedium)
+		}
+	}
+
+	if h := lv.GetString("history"); h != nil && strings.Contains(*h, "S") && !strings.Contains(*h, "h") {
+		raise(zeekocsf.SeverityLow)
+	}
+
+	if d := lv.GetFloat64("duration"); d != nil && *d >= longFlowSeconds && origBytes+respBytes >= bulkFlowBytes {
+		if p := lv.GetInt64("id.resp_p"); p != nil && !commonPorts[*p] {
+			raise(zeekocsf.SeverityLow)
+		}
+	}
+
+	return severity
+}
+
+func int64Or(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
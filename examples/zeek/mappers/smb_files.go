@@ -0,0 +1,120 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SMBFilesUnmapped struct {
+	PrevName    *string `json:"prev_name,omitempty"`
+	ChangedTime *int64  `json:"changed_time,omitempty"`
+	FUID        *string `json:"fuid,omitempty"`
+	DataOffset  *int64  `json:"data_offset_req,omitempty"`
+	DataLen     *int64  `json:"data_len_req,omitempty"`
+	DataLenRsp  *int64  `json:"data_len_rsp,omitempty"`
+}
+
+// shareTypes maps the object class in an SMB::Action (SMB::FILE_OPEN,
+// SMB::PIPE_READ, SMB::PRINT_WRITE, ...) to the OCSF share type.
+var shareTypes = map[string]struct {
+	name string
+	id   int32
+}{
+	"FILE":  {"File", 1},
+	"PIPE":  {"Pipe", 2},
+	"PRINT": {"Print", 3},
+}
+
+func MapZeekSMBFiles(lv tangent_sdk.Log) (*v1_5_0.SMBActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4006 // smb_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	var action string
+	if a := lv.GetString("action"); a != nil {
+		action = *a
+	}
+	command := strings.TrimPrefix(action, "SMB::")
+	kind, op, _ := strings.Cut(command, "_")
+
+	// OCSF only models how a file was opened; reads, writes, renames and
+	// closes are reported as "Other" with the Zeek action as the name.
+	var activityID int32 = 99 // other
+	var activityName *string
+	if op == "OPEN" {
+		activityID = 2 // file open
+	} else {
+		activityName = &command
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	share := lv.GetString("path")
+	name := lv.GetString("name")
+	var file *v1_5_0.File
+	if name != nil {
+		file = &v1_5_0.File{Name: *name, TypeId: 1, Size: lv.GetInt64("size")}
+		if kind == "PIPE" {
+			file.TypeId = 6 // named pipe
+		}
+		if share != nil {
+			p := strings.TrimSuffix(*share, `\`) + `\` + strings.TrimPrefix(*name, `\`)
+			file.Path = &p
+		}
+		if ms, ok, err := zeekocsf.GetTime(lv, "times.created"); ok && err == nil {
+			file.CreatedTime = ms
+		}
+		if ms, ok, err := zeekocsf.GetTime(lv, "times.modified"); ok && err == nil {
+			file.ModifiedTime = ms
+		}
+		if ms, ok, err := zeekocsf.GetTime(lv, "times.accessed"); ok && err == nil {
+			file.AccessedTime = ms
+		}
+	}
+
+	var shareType *string
+	var shareTypeID *int32
+	if st, ok := shareTypes[kind]; ok {
+		shareType, shareTypeID = &st.name, &st.id
+	}
+
+	var unmapped SMBFilesUnmapped
+	unmapped.PrevName = lv.GetString("prev_name")
+	if ms, ok, err := zeekocsf.GetTime(lv, "times.changed"); ok && err == nil {
+		unmapped.ChangedTime = &ms
+	}
+	unmapped.FUID = lv.GetString("fuid")
+	unmapped.DataOffset = lv.GetInt64("data_offset_req")
+	unmapped.DataLen = lv.GetInt64("data_len_req")
+	unmapped.DataLenRsp = lv.GetInt64("data_len_rsp")
+
+	return &v1_5_0.SMBActivity{
+		ActivityId:   activityID,
+		ActivityName: activityName,
+		CategoryUid:  categoryUID,
+		ClassUid:     classUID,
+		SeverityId:   severityID,
+		TypeUid:      typeUID,
+		Time:         timeMs,
+		Metadata:     zeekocsf.Metadata(lv),
+		SrcEndpoint:  src,
+		DstEndpoint:  dst,
+		Command:      &command,
+		File:         file,
+		Share:        share,
+		ShareType:    shareType,
+		ShareTypeId:  shareTypeID,
+		Unmapped:     zeekocsf.Unmapped(unmapped),
+	}, nil
+}
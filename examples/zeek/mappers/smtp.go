@@ -0,0 +1,146 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SMTPUnmapped struct {
+	TransDepth     *int64   `json:"trans_depth,omitempty"`
+	Helo           *string  `json:"helo,omitempty"`
+	HeaderFrom     *string  `json:"from,omitempty"`
+	HeaderTo       []string `json:"to,omitempty"`
+	ReplyTo        *string  `json:"reply_to,omitempty"`
+	InReplyTo      *string  `json:"in_reply_to,omitempty"`
+	Date           *string  `json:"date,omitempty"`
+	FirstReceived  *string  `json:"first_received,omitempty"`
+	SecondReceived *string  `json:"second_received,omitempty"`
+	Path           []string `json:"path,omitempty"`
+	UserAgent      *string  `json:"user_agent,omitempty"`
+	TLS            *bool    `json:"tls,omitempty"`
+	IsWebmail      *bool    `json:"is_webmail,omitempty"`
+}
+
+func MapZeekSMTP(lv tangent_sdk.Log) (*v1_5_0.EmailActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4009 // email_activity
+	const categoryUID int32 = 4 // Network Activity
+	const activityID int32 = 1  // send
+	var severityID int32 = 1
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	email := v1_5_0.Email{
+		Subject: lv.GetString("subject"),
+		Uid:     lv.GetString("msg_id"),
+	}
+	if from := lv.GetString("mailfrom"); from != nil {
+		if addrs := splitAddrs([]string{*from}); len(addrs) > 0 {
+			email.From = &addrs[0]
+		}
+	}
+	rcptto, _ := lv.GetStringList("rcptto")
+	email.To = splitAddrs(rcptto)
+	cc, _ := lv.GetStringList("cc")
+	email.Cc = splitAddrs(cc)
+	if xoip := lv.GetString("x_originating_ip"); xoip != nil {
+		email.XOriginatingIp = []string{*xoip}
+	}
+	fuids, _ := lv.GetStringList("fuids")
+	for i := range fuids {
+		email.Files = append(email.Files, v1_5_0.File{TypeId: 1, Uid: &fuids[i]})
+	}
+
+	var status, statusCode *string
+	var statusID *int32
+	statusDetail := lv.GetString("last_reply")
+	if statusDetail != nil {
+		status, statusCode, statusID = replyStatus(*statusDetail)
+	}
+
+	protocol := "SMTP"
+
+	var unmapped SMTPUnmapped
+	unmapped.TransDepth = lv.GetInt64("trans_depth")
+	unmapped.Helo = lv.GetString("helo")
+	unmapped.HeaderFrom = lv.GetString("from")
+	unmapped.HeaderTo, _ = lv.GetStringList("to")
+	unmapped.ReplyTo = lv.GetString("reply_to")
+	unmapped.InReplyTo = lv.GetString("in_reply_to")
+	unmapped.Date = lv.GetString("date")
+	unmapped.FirstReceived = lv.GetString("first_received")
+	unmapped.SecondReceived = lv.GetString("second_received")
+	unmapped.Path, _ = lv.GetStringList("path")
+	unmapped.UserAgent = lv.GetString("user_agent")
+	unmapped.TLS = lv.GetBool("tls")
+	unmapped.IsWebmail = lv.GetBool("is_webmail")
+
+	return &v1_5_0.EmailActivity{
+		ActivityId:   activityID,
+		CategoryUid:  categoryUID,
+		ClassUid:     classUID,
+		SeverityId:   severityID,
+		TypeUid:      typeUID,
+		Time:         timeMs,
+		Metadata:     zeekocsf.Metadata(lv),
+		SrcEndpoint:  src,
+		DstEndpoint:  dst,
+		Email:        email,
+		ProtocolName: &protocol,
+		Status:       status,
+		StatusCode:   statusCode,
+		StatusDetail: statusDetail,
+		StatusId:     statusID,
+		Unmapped:     zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// splitAddrs flattens Zeek address sets into bare addresses. Zeek keeps the
+// angle brackets from the SMTP command and can log a whole header list in
+// one entry, so "<a@x>, Bob <b@y>" becomes ["a@x", "b@y"].
+func splitAddrs(entries []string) []string {
+	var out []string
+	for _, e := range entries {
+		for _, a := range strings.Split(e, ",") {
+			a = strings.TrimSpace(a)
+			if i := strings.LastIndexByte(a, '<'); i >= 0 {
+				a = a[i+1:]
+			}
+			a = strings.TrimSpace(strings.TrimSuffix(a, ">"))
+			if a != "" {
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
+
+// replyStatus reads the SMTP reply code off the front of last_reply: 2xx and
+// 3xx are success, 4xx and 5xx failure.
+func replyStatus(reply string) (status, code *string, id *int32) {
+	if len(reply) < 3 {
+		return nil, nil, nil
+	}
+	c := reply[:3]
+	var s string
+	var i int32
+	switch c[0] {
+	case '2', '3':
+		s, i = "Success", 1
+	case '4', '5':
+		s, i = "Failure", 2
+	default:
+		return nil, nil, nil
+	}
+	return &s, &c, &i
+}
@@ -0,0 +1,117 @@
+package mappers
+
+import (
+	"strconv"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SSHUnmapped struct {
+	AuthAttempts   *int64   `json:"auth_attempts,omitempty"`
+	Client         *string  `json:"client,omitempty"`
+	Server         *string  `json:"server,omitempty"`
+	CipherAlg      *string  `json:"cipher_alg,omitempty"`
+	MACAlg         *string  `json:"mac_alg,omitempty"`
+	CompressionAlg *string  `json:"compression_alg,omitempty"`
+	KexAlg         *string  `json:"kex_alg,omitempty"`
+	HostKeyAlg     *string  `json:"host_key_alg,omitempty"`
+	HostKey        *string  `json:"host_key,omitempty"`
+	HasshVersion   *string  `json:"hasshVersion,omitempty"`
+	Inferences     []string `json:"inferences,omitempty"`
+}
+
+func MapZeekSSH(lv tangent_sdk.Log) (*v1_5_0.SSHActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4007 // ssh_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	// Zeek leaves auth_success unset when it could not tell, e.g. when the
+	// session closed before the heuristics had enough packets.
+	var activityID int32 = 6 // traffic
+	status, statusID := "Unknown", int32(0)
+	if ok := lv.GetBool("auth_success"); ok != nil {
+		if *ok {
+			activityID = 1 // open
+			status, statusID = "Success", 1
+		} else {
+			activityID = 4 // fail
+			status, statusID = "Failure", 2
+		}
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	var connInfo *v1_5_0.NetworkConnectionInformation
+	if d := lv.GetString("direction"); d != nil {
+		switch *d {
+		case "INBOUND":
+			connInfo = &v1_5_0.NetworkConnectionInformation{DirectionId: 1}
+		case "OUTBOUND":
+			connInfo = &v1_5_0.NetworkConnectionInformation{DirectionId: 2}
+		}
+	}
+
+	var protocolVer *string
+	if v := lv.GetInt64("version"); v != nil {
+		s := strconv.FormatInt(*v, 10)
+		protocolVer = &s
+	}
+
+	var unmapped SSHUnmapped
+	unmapped.AuthAttempts = lv.GetInt64("auth_attempts")
+	unmapped.Client = lv.GetString("client")
+	unmapped.Server = lv.GetString("server")
+	unmapped.CipherAlg = lv.GetString("cipher_alg")
+	unmapped.MACAlg = lv.GetString("mac_alg")
+	unmapped.CompressionAlg = lv.GetString("compression_alg")
+	unmapped.KexAlg = lv.GetString("kex_alg")
+	unmapped.HostKeyAlg = lv.GetString("host_key_alg")
+	unmapped.HostKey = lv.GetString("host_key")
+	unmapped.HasshVersion = lv.GetString("hasshVersion")
+	unmapped.Inferences, _ = lv.GetStringList("inferences")
+
+	return &v1_5_0.SSHActivity{
+		ActivityId:     activityID,
+		CategoryUid:    categoryUID,
+		ClassUid:       classUID,
+		SeverityId:     severityID,
+		TypeUid:        typeUID,
+		Time:           timeMs,
+		Metadata:       zeekocsf.Metadata(lv),
+		SrcEndpoint:    src,
+		DstEndpoint:    dst,
+		ConnectionInfo: connInfo,
+		ProtocolVer:    protocolVer,
+		ClientHassh:    hassh(lv.GetString("hassh"), lv.GetString("hasshAlgorithms")),
+		ServerHassh:    hassh(lv.GetString("hasshServer"), lv.GetString("hasshServerAlgorithms")),
+		Status:         &status,
+		StatusId:       &statusID,
+		Unmapped:       zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// hassh pairs a HASSH md5 with the algorithm string it was computed from.
+func hassh(fp, algorithms *string) *v1_5_0.HASSH {
+	if fp == nil {
+		return nil
+	}
+	md5 := "MD5"
+	return &v1_5_0.HASSH{
+		Algorithm: algorithms,
+		Fingerprint: v1_5_0.Fingerprint{
+			Algorithm:   &md5,
+			AlgorithmId: 1,
+			Value:       *fp,
+		},
+	}
+}
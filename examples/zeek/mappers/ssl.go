@@ -0,0 +1,144 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SSLUnmapped struct {
+	Curve                *string  `json:"curve,omitempty"`
+	Resumed              *bool    `json:"resumed,omitempty"`
+	Established          *bool    `json:"established,omitempty"`
+	LastAlert            *string  `json:"last_alert,omitempty"`
+	NextProtocol         *string  `json:"next_protocol,omitempty"`
+	SSLHistory           *string  `json:"ssl_history,omitempty"`
+	SNIMatchesCert       *bool    `json:"sni_matches_cert,omitempty"`
+	CertChainFuids       []string `json:"cert_chain_fuids,omitempty"`
+	ClientCertChainFuids []string `json:"client_cert_chain_fuids,omitempty"`
+	CertChainFps         []string `json:"cert_chain_fps,omitempty"`
+	ClientCertChainFps   []string `json:"client_cert_chain_fps,omitempty"`
+	ClientSubject        *string  `json:"client_subject,omitempty"`
+	ClientIssuer         *string  `json:"client_issuer,omitempty"`
+}
+
+func MapZeekSSL(lv tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4001 // network_activity
+	const categoryUID int32 = 4 // Network Activity
+	var activityID int32 = 6    // traffic
+	var severityID int32 = 1
+
+	established := lv.GetBool("established")
+	if established != nil && !*established {
+		activityID = 4 // fail
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	src, dst := zeekocsf.Endpoints(lv)
+
+	tls := &v1_5_0.TransportLayerSecurityTLS{
+		Cipher: lv.GetString("cipher"),
+		Sni:    lv.GetString("server_name"),
+	}
+	if v := lv.GetString("version"); v != nil {
+		tls.Version = tlsVersion(*v)
+	}
+	if ja3 := lv.GetString("ja3"); ja3 != nil {
+		tls.Ja3Hash = md5Fingerprint(*ja3)
+	}
+	if ja3s := lv.GetString("ja3s"); ja3s != nil {
+		tls.Ja3sHash = md5Fingerprint(*ja3s)
+	}
+	subject := lv.GetString("subject")
+	issuer := lv.GetString("issuer")
+	if subject != nil || issuer != nil {
+		cert := &v1_5_0.DigitalCertificate{Subject: subject}
+		if issuer != nil {
+			cert.Issuer = *issuer
+		}
+		tls.Certificate = cert
+	}
+
+	var status *string
+	var statusID *int32
+	statusDetail := lv.GetString("validation_status")
+	if statusDetail != nil {
+		status, statusID = validationStatus(*statusDetail)
+	}
+
+	var unmapped SSLUnmapped
+	unmapped.Curve = lv.GetString("curve")
+	unmapped.Resumed = lv.GetBool("resumed")
+	unmapped.Established = established
+	unmapped.LastAlert = lv.GetString("last_alert")
+	unmapped.NextProtocol = lv.GetString("next_protocol")
+	unmapped.SSLHistory = lv.GetString("ssl_history")
+	unmapped.SNIMatchesCert = lv.GetBool("sni_matches_cert")
+	unmapped.CertChainFuids, _ = lv.GetStringList("cert_chain_fuids")
+	unmapped.ClientCertChainFuids, _ = lv.GetStringList("client_cert_chain_fuids")
+	unmapped.CertChainFps, _ = lv.GetStringList("cert_chain_fps")
+	unmapped.ClientCertChainFps, _ = lv.GetStringList("client_cert_chain_fps")
+	unmapped.ClientSubject = lv.GetString("client_subject")
+	unmapped.ClientIssuer = lv.GetString("client_issuer")
+
+	return &v1_5_0.NetworkActivity{
+		ActivityId:   activityID,
+		CategoryUid:  categoryUID,
+		ClassUid:     classUID,
+		SeverityId:   severityID,
+		TypeUid:      typeUID,
+		Time:         timeMs,
+		Metadata:     zeekocsf.Metadata(lv),
+		SrcEndpoint:  src,
+		DstEndpoint:  dst,
+		Tls:          tls,
+		Status:       status,
+		StatusId:     statusID,
+		StatusDetail: statusDetail,
+		Unmapped:     zeekocsf.Unmapped(unmapped),
+	}, nil
+}
+
+// tlsVersion turns Zeek's "TLSv12" / "SSLv3" into "1.2" / "SSL 3.0". DTLS
+// and anything unrecognised pass through untouched.
+func tlsVersion(v string) string {
+	switch v {
+	case "SSLv2":
+		return "SSL 2.0"
+	case "SSLv3":
+		return "SSL 3.0"
+	case "TLSv10":
+		return "1.0"
+	case "TLSv11":
+		return "1.1"
+	case "TLSv12":
+		return "1.2"
+	case "TLSv13":
+		return "1.3"
+	}
+	return v
+}
+
+func md5Fingerprint(v string) *v1_5_0.Fingerprint {
+	alg := "MD5"
+	return &v1_5_0.Fingerprint{Algorithm: &alg, AlgorithmId: 1, Value: v}
+}
+
+// validationStatus maps Zeek's certificate validation result to an OCSF
+// status: "ok" is success, any OpenSSL error string is a failure.
+func validationStatus(v string) (*string, *int32) {
+	status, id := "Failure", int32(2)
+	if strings.EqualFold(v, "ok") {
+		status, id = "Success", 1
+	}
+	return &status, &id
+}
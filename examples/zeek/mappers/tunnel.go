@@ -0,0 +1,91 @@
+package mappers
+
+import (
+	"strings"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type TunnelUnmapped struct {
+	TunnelType *string `json:"tunnel_type,omitempty"`
+	Action     *string `json:"action,omitempty"`
+}
+
+// tunnelTypes names each Tunnel::Type and gives the IP protocol carrying the
+// outer packets.
+var tunnelTypes = map[string]struct {
+	name  string
+	proto int32
+}{
+	"AYIYA":  {"AYIYA", 17},
+	"GENEVE": {"Geneve", 17},
+	"GRE":    {"GRE", 47},
+	"GTPv1":  {"GTPv1", 17},
+	"HTTP":   {"HTTP", 6},
+	"IP":     {"IP-in-IP", 4},
+	"SOCKS":  {"SOCKS", 6},
+	"TEREDO": {"Teredo", 17},
+	"VXLAN":  {"VXLAN", 17},
+}
+
+func MapZeekTunnel(lv tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4001 // network_activity
+	const categoryUID int32 = 4 // Network Activity
+	var severityID int32 = 1
+
+	action := lv.GetString("action")
+	var activityID int32 = 99 // other
+	if action != nil {
+		switch strings.TrimPrefix(*action, "Tunnel::") {
+		case "DISCOVER":
+			activityID = 1 // open
+		case "CLOSE", "EXPIRE":
+			activityID = 2 // close
+		}
+	}
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	// GRE and IP-in-IP have no ports; Endpoints leaves them off.
+	src, dst := zeekocsf.Endpoints(lv)
+
+	tunnelType := lv.GetString("tunnel_type")
+	var connInfo *v1_5_0.NetworkConnectionInformation
+	if tunnelType != nil {
+		connInfo = &v1_5_0.NetworkConnectionInformation{}
+		t := strings.TrimPrefix(*tunnelType, "Tunnel::")
+		if tt, ok := tunnelTypes[t]; ok {
+			connInfo.ProtocolName = &tt.name
+			connInfo.ProtocolNum = &tt.proto
+		} else {
+			connInfo.ProtocolName = &t
+		}
+	}
+
+	unmapped := TunnelUnmapped{
+		TunnelType: tunnelType,
+		Action:     action,
+	}
+
+	return &v1_5_0.NetworkActivity{
+		ActivityId:     activityID,
+		CategoryUid:    categoryUID,
+		ClassUid:       classUID,
+		SeverityId:     severityID,
+		TypeUid:        typeUID,
+		Time:           timeMs,
+		Metadata:       zeekocsf.Metadata(lv),
+		SrcEndpoint:    src,
+		DstEndpoint:    dst,
+		ConnectionInfo: connInfo,
+		Unmapped:       zeekocsf.Unmapped(unmapped),
+	}, nil
+}
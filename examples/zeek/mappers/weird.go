@@ -0,0 +1,87 @@
+package mappers
+
+import (
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type WeirdUnmapped struct {
+	Notice *bool   `json:"notice,omitempty"`
+	Peer   *string `json:"peer,omitempty"`
+	Source *string `json:"source,omitempty"`
+}
+
+// MapZeekWeird turns a protocol anomaly into an informational finding, or a
+// low one when Zeek also raised it as a notice.
+func MapZeekWeird(lv tangent_sdk.Log) (*v1_5_0.DetectionFinding, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 2004 // detection_finding
+	const categoryUID int32 = 2 // Findings
+	const activityID int32 = 1  // create
+	typeUID := int64(classUID)*100 + int64(activityID)
+
+	var name string
+	if n := lv.GetString("name"); n != nil {
+		name = *n
+	}
+
+	severityID := zeekocsf.SeverityInformational
+	notice := lv.GetBool("notice")
+	if notice != nil && *notice {
+		severityID = zeekocsf.SeverityLow
+	}
+	severity := zeekocsf.SeverityName(severityID)
+
+	message := lv.GetString("addl")
+	if message == nil {
+		message = &name
+	}
+
+	info := v1_5_0.FindingInformation{
+		Title: &name,
+		Types: []string{"Weird::" + name},
+	}
+	// Weirds raised outside any connection (e.g. truncated_header on a
+	// packet that never got that far) have no uid or tuple.
+	if uid := lv.GetString("uid"); uid != nil {
+		info.Uid = *uid
+	}
+
+	var evidences []v1_5_0.EvidenceArtifacts
+	if src, dst := zeekocsf.Endpoints(lv); src != nil || dst != nil {
+		evidences = []v1_5_0.EvidenceArtifacts{{SrcEndpoint: src, DstEndpoint: dst}}
+	}
+
+	unmapped := WeirdUnmapped{
+		Notice: notice,
+		Peer:   lv.GetString("peer"),
+		Source: lv.GetString("source"),
+	}
+
+	status, statusID := "New", int32(1)
+
+	return &v1_5_0.DetectionFinding{
+		ActivityId:  activityID,
+		CategoryUid: categoryUID,
+		ClassUid:    classUID,
+		SeverityId:  severityID,
+		Severity:    &severity,
+		TypeUid:     typeUID,
+		Time:        timeMs,
+		Metadata:    zeekocsf.Metadata(lv),
+		FindingInfo: info,
+		Message:     message,
+		Evidences:   evidences,
+		IsAlert:     notice,
+		Status:      &status,
+		StatusId:    &statusID,
+		Unmapped:    zeekocsf.Unmapped(unmapped),
+	}, nil
+}
@@ -0,0 +1,131 @@
+package mappers
+
+import (
+	"strconv"
+
+	"zeek/zeekocsf"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type BasicConstraints struct {
+	CA      *bool  `json:"ca,omitempty"`
+	PathLen *int64 `json:"path_len,omitempty"`
+}
+
+type X509Unmapped struct {
+	KeyAlg           *string           `json:"key_alg,omitempty"`
+	SigAlg           *string           `json:"sig_alg,omitempty"`
+	KeyType          *string           `json:"key_type,omitempty"`
+	Exponent         *string           `json:"exponent,omitempty"`
+	Curve            *string           `json:"curve,omitempty"`
+	BasicConstraints *BasicConstraints `json:"basic_constraints,omitempty"`
+	Extensions       []string          `json:"extensions,omitempty"`
+	HostCert         *bool             `json:"host_cert,omitempty"`
+	ClientCert       *bool             `json:"client_cert,omitempty"`
+}
+
+// MapZeekX509 carries a certificate seen on the wire in tls.certificate.
+// OCSF has no certificate event class, so it is a Network Activity with
+// activity "Other"; metadata.uid is the certificate's fuid, which ssl.log
+// lists in cert_chain_fuids and files.log logs as fuid.
+func MapZeekX509(lv tangent_sdk.Log) (*v1_5_0.NetworkActivity, error) {
+	timeMs, err := zeekocsf.Time(lv)
+	if err != nil {
+		return nil, err
+	}
+
+	const classUID int32 = 4001 // network_activity
+	const categoryUID int32 = 4 // Network Activity
+	const activityID int32 = 99 // other
+	var severityID int32 = 1
+	typeUID := int64(classUID)*100 + int64(activityID)
+	activityName := "Certificate"
+
+	md := zeekocsf.Metadata(lv)
+	// Zeek 4 and earlier called the file id "id".
+	md.Uid = lv.GetString("fuid")
+	if md.Uid == nil {
+		md.Uid = lv.GetString("id")
+	}
+
+	cert := &v1_5_0.DigitalCertificate{
+		Uid:     md.Uid,
+		Subject: lv.GetString("certificate.subject"),
+	}
+	if issuer := lv.GetString("certificate.issuer"); issuer != nil {
+		cert.Issuer = *issuer
+		if cert.Subject != nil {
+			selfSigned := *cert.Subject == *issuer
+			cert.IsSelfSigned = &selfSigned
+		}
+	}
+	if serial := lv.GetString("certificate.serial"); serial != nil {
+		cert.SerialNumber = *serial
+	}
+	if v := lv.GetInt64("certificate.version"); v != nil {
+		s := strconv.FormatInt(*v, 10)
+		cert.Version = &s
+	}
+	if ms, ok, err := zeekocsf.GetTime(lv, "certificate.not_valid_before"); ok && err == nil {
+		cert.CreatedTime = ms
+	}
+	if ms, ok, err := zeekocsf.GetTime(lv, "certificate.not_valid_after"); ok && err == nil {
+		cert.ExpirationTime = ms
+	}
+	if fp := lv.GetString("fingerprint"); fp != nil {
+		alg := "SHA-256"
+		cert.Fingerprints = []v1_5_0.Fingerprint{{
+			Algorithm:   &alg,
+			AlgorithmId: 3,
+			Value:       *fp,
+		}}
+	}
+	for _, san := range []struct{ field, typ string }{
+		{"san.dns", "DNS"},
+		{"san.uri", "URI"},
+		{"san.email", "Email"},
+		{"san.ip", "IP Address"},
+	} {
+		vals, _ := lv.GetStringList(san.field)
+		for _, v := range vals {
+			cert.Sans = append(cert.Sans, v1_5_0.SubjectAlternativeName{Name: v, Type: san.typ})
+		}
+	}
+
+	tls := &v1_5_0.TransportLayerSecurityTLS{Certificate: cert}
+	if kl := lv.GetInt64("certificate.key_length"); kl != nil {
+		k := int32(*kl)
+		tls.KeyLength = &k
+	}
+
+	var unmapped X509Unmapped
+	unmapped.KeyAlg = lv.GetString("certificate.key_alg")
+	unmapped.SigAlg = lv.GetString("certificate.sig_alg")
+	unmapped.KeyType = lv.GetString("certificate.key_type")
+	unmapped.Exponent = lv.GetString("certificate.exponent")
+	unmapped.Curve = lv.GetString("certificate.curve")
+	ca := lv.GetBool("basic_constraints.ca")
+	pathLen := lv.GetInt64("basic_constraints.path_len")
+	if ca != nil || pathLen != nil {
+		unmapped.BasicConstraints = &BasicConstraints{CA: ca, PathLen: pathLen}
+	}
+	unmapped.Extensions, _ = lv.GetStringList("extensions")
+	unmapped.HostCert = lv.GetBool("host_cert")
+	unmapped.ClientCert = lv.GetBool("client_cert")
+
+	return &v1_5_0.NetworkActivity{
+		ActivityId:   activityID,
+		ActivityName: &activityName,
+		CategoryUid:  categoryUID,
+		ClassUid:     classUID,
+		SeverityId:   severityID,
+		TypeUid:      typeUID,
+		Time:         timeMs,
+		Metadata:     md,
+		Tls:          tls,
+		Unmapped:     zeekocsf.Unmapped(unmapped),
+	}, nil
+}
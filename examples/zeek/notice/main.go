@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type DetectionFindingAlias v1_5_0.DetectionFinding
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-notice → ocsf.detection_finding",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("note"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "notice"),
+		},
+	},
+}
+
+func MapZeekNotice(lv tangent_sdk.Log) (*DetectionFindingAlias, error) {
+	out, err := mappers.MapZeekNotice(lv)
+	return (*DetectionFindingAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*DetectionFindingAlias](
+		metadata,
+		selectors,
+		MapZeekNotice,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type RDPActivityAlias v1_5_0.RDPActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-rdp → ocsf.rdp_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("uid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "rdp"),
+		},
+	},
+}
+
+func MapZeekRDP(lv tangent_sdk.Log) (*RDPActivityAlias, error) {
+	out, err := mappers.MapZeekRDP(lv)
+	return (*RDPActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*RDPActivityAlias](
+		metadata,
+		selectors,
+		MapZeekRDP,
+		nil,
+	)
+}
+func main() {}
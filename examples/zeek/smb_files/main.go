@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SMBActivityAlias v1_5_0.SMBActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-smb_files → ocsf.smb_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("action"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "smb_files"),
+		},
+	},
+}
+
+func MapZeekSMBFiles(lv tangent_sdk.Log) (*SMBActivityAlias, error) {
+	out, err := mappers.MapZeekSMBFiles(lv)
+	return (*SMBActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*SMBActivityAlias](
+		metadata,
+		selectors,
+		MapZeekSMBFiles,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type EmailActivityAlias v1_5_0.EmailActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-smtp → ocsf.email_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("uid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "smtp"),
+		},
+	},
+}
+
+func MapZeekSMTP(lv tangent_sdk.Log) (*EmailActivityAlias, error) {
+	out, err := mappers.MapZeekSMTP(lv)
+	return (*EmailActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*EmailActivityAlias](
+		metadata,
+		selectors,
+		MapZeekSMTP,
+		nil,
+	)
+}
+func main() {}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type SSHActivityAlias v1_5_0.SSHActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-ssh → ocsf.ssh_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("uid"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "ssh"),
+		},
+	},
+}
+
+func MapZeekSSH(lv tangent_sdk.Log) (*SSHActivityAlias, error) {
+	out, err := mappers.MapZeekSSH(lv)
+	return (*SSHActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*SSHActivityAlias](
+		metadata,
+		selectors,
+		MapZeekSSH,
+		nil,
+	)
+}
+func main() {}
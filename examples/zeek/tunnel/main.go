@@ -0,0 +1,41 @@
+package main
+
+import (
+	"zeek/mappers"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+type NetworkActivityAlias v1_5_0.NetworkActivity
+
+var metadata = tangent_sdk.Metadata{
+	Name:    "zeek-tunnel → ocsf.network_activity",
+	Version: "0.1.0",
+}
+
+var selectors = []tangent_sdk.Selector{
+	{
+		All: []tangent_sdk.Predicate{
+			tangent_sdk.Has("tunnel_type"),
+			tangent_sdk.Has("ts"),
+			tangent_sdk.EqString("_path", "tunnel"),
+		},
+	},
+}
+
+func MapZeekTunnel(lv tangent_sdk.Log) (*NetworkActivityAlias, error) {
+	out, err := mappers.MapZeekTunnel(lv)
+	return (*NetworkActivityAlias)(out), err
+}
+
+func init() {
+	tangent_sdk.Wire[*NetworkActivityAlias](
+		metadata,
+		selectors,
+		MapZeekTunnel,
+		nil,
+	)
+}
+func main() {}
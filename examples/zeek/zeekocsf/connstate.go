@@ -0,0 +1,56 @@
+package zeekocsf
+
+// OCSF Network Activity activity_id values.
+const (
+	ActivityOpen    int32 = 1
+	ActivityClose   int32 = 2
+	ActivityReset   int32 = 3
+	ActivityFail    int32 = 4
+	ActivityRefuse  int32 = 5
+	ActivityTraffic int32 = 6
+)
+
+// OCSF status_id values.
+const (
+	StatusUnknown int32 = 0
+	StatusSuccess int32 = 1
+	StatusFailure int32 = 2
+)
+
+// ConnState is what a Zeek conn_state says about a connection in OCSF terms.
+// Status records whether the connection was ever established; Detail is
+// Zeek's own description of the state.
+type ConnState struct {
+	ActivityID int32
+	StatusID   int32
+	Detail     string
+}
+
+// ConnStates covers every conn_state documented for conn.log.
+var ConnStates = map[string]ConnState{
+	"S0":     {ActivityFail, StatusFailure, "Connection attempt seen, no reply"},
+	"S1":     {ActivityOpen, StatusSuccess, "Connection established, not terminated"},
+	"SF":     {ActivityClose, StatusSuccess, "Normal establishment and termination"},
+	"REJ":    {ActivityRefuse, StatusFailure, "Connection attempt rejected"},
+	"S2":     {ActivityClose, StatusSuccess, "Established, close attempt by originator seen (no reply from responder)"},
+	"S3":     {ActivityClose, StatusSuccess, "Established, close attempt by responder seen (no reply from originator)"},
+	"RSTO":   {ActivityReset, StatusSuccess, "Connection established, originator aborted (sent a RST)"},
+	"RSTR":   {ActivityReset, StatusSuccess, "Responder sent a RST"},
+	"RSTOS0": {ActivityReset, StatusFailure, "Originator sent a SYN followed by a RST, never saw a SYN-ACK from the responder"},
+	"RSTRH":  {ActivityReset, StatusFailure, "Responder sent a SYN ACK followed by a RST, never saw a SYN from the (purported) originator"},
+	"SH":     {ActivityFail, StatusFailure, "Originator sent a SYN followed by a FIN, never saw a SYN ACK from the responder (half-open)"},
+	"SHR":    {ActivityFail, StatusFailure, "Responder sent a SYN ACK followed by a FIN, never saw a SYN from the originator"},
+	"OTH":    {ActivityTraffic, StatusUnknown, "No SYN seen, just midstream traffic"},
+}
+
+// StatusName returns the OCSF caption for a status_id.
+func StatusName(id int32) string {
+	switch id {
+	case StatusSuccess:
+		return "Success"
+	case StatusFailure:
+		return "Failure"
+	default:
+		return "Unknown"
+	}
+}
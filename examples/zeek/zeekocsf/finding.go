@@ -0,0 +1,76 @@
+package zeekocsf
+
+import "strings"
+
+// OCSF severity_id values.
+const (
+	SeverityInformational int32 = 1
+	SeverityLow           int32 = 2
+	SeverityMedium        int32 = 3
+	SeverityHigh          int32 = 4
+	SeverityCritical      int32 = 5
+)
+
+// NoticeSeverity maps a Zeek notice type to an OCSF severity_id. Keys are
+// either a full note ("SSH::Password_Guessing") or a module prefix ending
+// in "::" ("Scan::") that covers every note in it. Deployments change the
+// ranking by editing entries here.
+var NoticeSeverity = map[string]int32{
+	"CaptureLoss::Too_Much_Loss":               SeverityLow,
+	"Conn::Content_Gap":                        SeverityLow,
+	"Conn::Retransmission_Inconsistency":       SeverityLow,
+	"DNS::External_Name":                       SeverityLow,
+	"FTP::Bruteforcing":                        SeverityHigh,
+	"Heartbleed::SSL_Heartbeat_Attack":         SeverityCritical,
+	"Heartbleed::SSL_Heartbeat_Attack_Success": SeverityCritical,
+	"HTTP::SQL_Injection_Attacker":             SeverityHigh,
+	"HTTP::SQL_Injection_Victim":               SeverityHigh,
+	"Intel::Notice":                            SeverityHigh,
+	"Notice::Tally":                            SeverityInformational,
+	"ProtocolDetector::Protocol_Found":         SeverityInformational,
+	"Scan::":                                   SeverityMedium,
+	"Signatures::Sensitive_Signature":          SeverityHigh,
+	"Software::Vulnerable_Version":             SeverityMedium,
+	"SSH::Interesting_Hostname_Login":          SeverityMedium,
+	"SSH::Password_Guessing":                   SeverityHigh,
+	"SSL::Certificate_Expired":                 SeverityLow,
+	"SSL::Certificate_Expires_Soon":            SeverityInformational,
+	"SSL::Invalid_Server_Cert":                 SeverityLow,
+	"TeamCymruMalwareHashRegistry::Match":      SeverityCritical,
+	"Traceroute::Detected":                     SeverityInformational,
+	"Weird::Activity":                          SeverityLow,
+}
+
+// DefaultNoticeSeverity applies to notes with no NoticeSeverity entry.
+var DefaultNoticeSeverity = SeverityMedium
+
+// NoticeSeverityID looks the note up in NoticeSeverity, trying the exact
+// note before its module prefix.
+func NoticeSeverityID(note string) int32 {
+	if sev, ok := NoticeSeverity[note]; ok {
+		return sev
+	}
+	if i := strings.Index(note, "::"); i >= 0 {
+		if sev, ok := NoticeSeverity[note[:i+2]]; ok {
+			return sev
+		}
+	}
+	return DefaultNoticeSeverity
+}
+
+// SeverityName is the OCSF caption for a severity_id.
+func SeverityName(id int32) string {
+	switch id {
+	case SeverityInformational:
+		return "Informational"
+	case SeverityLow:
+		return "Low"
+	case SeverityMedium:
+		return "Medium"
+	case SeverityHigh:
+		return "High"
+	case SeverityCritical:
+		return "Critical"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,161 @@
+// Package zeekocsf holds the pieces shared by the Zeek mappers: record
+// timestamps, endpoints and OCSF metadata.
+package zeekocsf
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/telophasehq/go-ocsf/ocsf/v1_5_0"
+
+	tangent_sdk "github.com/telophasehq/tangent-sdk-go"
+)
+
+const OCSFVersion = "1.5.0"
+
+var ErrMissingTS = errors.New("zeek record has no ts")
+
+// Time returns the record's ts in epoch milliseconds.
+func Time(lv tangent_sdk.Log) (int64, error) {
+	ms, ok, err := GetTime(lv, "ts")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrMissingTS
+	}
+	return ms, nil
+}
+
+// GetTime reads a Zeek timestamp in epoch milliseconds. Zeek writes either
+// RFC3339 strings (JSON::TS_ISO8601) or epoch seconds with a fraction (the
+// default); epoch milliseconds from re-exported logs are accepted too.
+// ok is false when the field is absent.
+func GetTime(lv tangent_sdk.Log, path string) (ms int64, ok bool, err error) {
+	if f := lv.GetFloat64(path); f != nil {
+		return epochMillis(*f), true, nil
+	}
+	if i := lv.GetInt64(path); i != nil {
+		return epochMillis(float64(*i)), true, nil
+	}
+	s := lv.GetString(path)
+	if s == nil {
+		return 0, false, nil
+	}
+	if f, err := strconv.ParseFloat(*s, 64); err == nil {
+		return epochMillis(f), true, nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, *s)
+	if err != nil {
+		return 0, true, err
+	}
+	return ts.UnixMilli(), true, nil
+}
+
+// epochMillis treats anything past 1e11 (the year 5138 in seconds) as
+// already being milliseconds.
+func epochMillis(v float64) int64 {
+	if math.Abs(v) >= 1e11 {
+		return int64(v)
+	}
+	// Round at microseconds first so 0.489 doesn't floor to 488ms.
+	return int64(math.Round(v*1e6)) / 1000
+}
+
+// Metadata fills the OCSF metadata common to every Zeek log: uid, log name,
+// write time and the sensor that produced it.
+func Metadata(lv tangent_sdk.Log) v1_5_0.Metadata {
+	productName := "Zeek"
+	vendorName := "Zeek"
+	md := v1_5_0.Metadata{
+		Version: OCSFVersion,
+		Uid:     lv.GetString("uid"),
+		Product: v1_5_0.Product{
+			Name:       &productName,
+			VendorName: &vendorName,
+		},
+		LogName: lv.GetString("_path"),
+	}
+	if wts, ok, err := GetTime(lv, "_write_ts"); ok && err == nil {
+		md.LoggedTime = wts
+	}
+	if systemName := lv.GetString("_system_name"); systemName != nil {
+		md.Loggers = []v1_5_0.Logger{{Name: systemName}}
+	}
+	return md
+}
+
+// NetEndpoint builds an endpoint from an address and port, normalizing the
+// address with NormalizeIP. A zero port is left out.
+func NetEndpoint(ip string, port int) *v1_5_0.NetworkEndpoint {
+	ep := &v1_5_0.NetworkEndpoint{}
+	if ip != "" {
+		ip = NormalizeIP(ip)
+		ep.Ip = &ip
+	}
+	if port != 0 {
+		p := int32(port)
+		ep.Port = &p
+	}
+	return ep
+}
+
+// NormalizeIP puts an address in canonical form so the same host always
+// compares equal: IPv6 zones ("fe80::1%eth0") are dropped, IPv4-mapped IPv6
+// ("::ffff:10.0.0.1") becomes plain IPv4 and IPv6 is lower-cased and
+// compressed. Anything that does not parse is returned unchanged.
+func NormalizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	return addr.WithZone("").Unmap().String()
+}
+
+// IPVersion returns the OCSF connection_info.protocol_ver_id and caption for
+// an address: 4 for IPv4, 6 for IPv6 and 0 (Unknown) otherwise.
+func IPVersion(ip string) (int32, string) {
+	addr, err := netip.ParseAddr(ip)
+	switch {
+	case err != nil:
+		return 0, "Unknown"
+	case addr.Unmap().Is4():
+		return 4, "Internet Protocol version 4 (IPv4)"
+	default:
+		return 6, "Internet Protocol version 6 (IPv6)"
+	}
+}
+
+// Endpoints builds the source and destination from the id.* connection
+// tuple. Either side is nil when its address is missing; the port is left
+// out for port-less protocols such as GRE, where Zeek logs none.
+func Endpoints(lv tangent_sdk.Log) (src, dst *v1_5_0.NetworkEndpoint) {
+	if h := lv.GetString("id.orig_h"); h != nil {
+		src = NetEndpoint(*h, port(lv.GetInt64("id.orig_p")))
+	}
+	if h := lv.GetString("id.resp_h"); h != nil {
+		dst = NetEndpoint(*h, port(lv.GetInt64("id.resp_p")))
+	}
+	return src, dst
+}
+
+func port(p *int64) int {
+	if p == nil {
+		return 0
+	}
+	return int(*p)
+}
+
+// Unmapped encodes the fields with no OCSF home. Returns nil if encoding fails.
+func Unmapped(v any) *string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	s := string(b)
+	return &s
+}